@@ -0,0 +1,14 @@
+// jaggertags runs the jaggertags analyzer, standalone or through go vet
+//
+//	go vet -vettool=$(which jaggertags) ./...
+package main
+
+import (
+	"golang.org/x/tools/go/analysis/singlechecker"
+
+	"github.com/tronikelis/jagger/analysis/jaggertags"
+)
+
+func main() {
+	singlechecker.Main(jaggertags.Analyzer)
+}
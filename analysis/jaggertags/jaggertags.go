@@ -0,0 +1,209 @@
+// Package jaggertags defines an analyzer which reports mistakes in jagger struct tags
+package jaggertags
+
+import (
+	"go/ast"
+	"go/types"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+	"golang.org/x/tools/go/ast/inspector"
+
+	"github.com/tronikelis/jagger/internal/typesutil"
+	"github.com/tronikelis/jagger/tags"
+)
+
+var Analyzer = &analysis.Analyzer{
+	Name:     "jaggertags",
+	Doc:      "check jagger struct tags for invalid options, duplicate pk and invalid relations",
+	URL:      "https://pkg.go.dev/github.com/tronikelis/jagger/analysis/jaggertags",
+	Requires: []*analysis.Analyzer{inspect.Analyzer},
+	Run:      run,
+}
+
+func run(pass *analysis.Pass) (any, error) {
+	inspect := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+
+	inspect.Preorder([]ast.Node{(*ast.StructType)(nil)}, func(n ast.Node) {
+		checkStruct(pass, n.(*ast.StructType))
+	})
+
+	return nil, nil
+}
+
+func fieldTag(field *ast.Field) reflect.StructTag {
+	if field.Tag == nil {
+		return ""
+	}
+
+	tag, err := strconv.Unquote(field.Tag.Value)
+	if err != nil {
+		return ""
+	}
+
+	return reflect.StructTag(tag)
+}
+
+func checkStruct(pass *analysis.Pass, st *ast.StructType) {
+	// the first field declaring pk:, including ones promoted by embed
+	var pk string
+
+	// the structs being embedded, a struct can embed a pointer to itself
+	chain := map[*types.Struct]bool{}
+	if outer, ok := pass.TypesInfo.TypeOf(st).(*types.Struct); ok {
+		chain[outer] = true
+	}
+
+	for _, field := range st.Fields.List {
+		tag := fieldTag(field)
+		name := fieldName(field)
+		typ := pass.TypesInfo.TypeOf(field.Type)
+		if typ == nil {
+			continue
+		}
+
+		if _, ok := tag.Lookup("jagger"); !ok {
+			// anonymous structs are flattened without a tag too
+			if typesutil.IsEmbed(len(field.Names) == 0, typ, tags.JaggerTag{}) {
+				for _, declared := range pks(name, typ, tags.JaggerTag{}, true, chain) {
+					if pk != "" {
+						pass.Reportf(field.Pos(), "%s declares pk: but %s already does", declared, pk)
+						continue
+					}
+					pk = declared
+				}
+			}
+			continue
+		}
+		if _, err := tags.NewJaggerTag(tag); err != nil {
+			pass.Reportf(field.Pos(), "%s: %v", name, err)
+		}
+		// keep checking what could be parsed
+		jaggerTag := tags.NewJaggerTagLenient(tag)
+
+		if typesutil.IsBaseTable(typ) {
+			continue
+		}
+
+		for _, declared := range pks(name, typ, jaggerTag, len(field.Names) == 0, chain) {
+			if pk != "" {
+				pass.Reportf(field.Pos(), "%s declares pk: but %s already does", declared, pk)
+				continue
+			}
+			pk = declared
+		}
+
+		if jaggerTag.Embed || jaggerTag.Group {
+			option := "embed"
+			if jaggerTag.Group {
+				option = "group"
+			}
+
+			if _, ok := deref(typ).Underlying().(*types.Struct); !ok {
+				pass.Reportf(field.Pos(), "%s on %s of non-struct type %s", option, name, typ)
+			}
+			continue
+		}
+
+		if jaggerTag.FK != "" {
+			checkRelation(pass, field, name, typ)
+
+			_, isMap := deref(typ).Underlying().(*types.Map)
+			switch {
+			case isMap && jaggerTag.Key == "":
+				pass.Reportf(field.Pos(), "map relation %s is missing key:", name)
+			case !isMap && jaggerTag.Key != "":
+				pass.Reportf(field.Pos(), "key: on %s of type %s, only map relations are keyed", name, typ)
+			}
+		}
+
+		if jaggerTag.Name != "-" && !reflect.ValueOf(jaggerTag).IsZero() {
+			if json, ok := tag.Lookup("json"); !ok || strings.Split(json, ",")[0] == "" {
+				pass.Reportf(field.Pos(), "%s is missing a json tag name", name)
+			}
+		}
+	}
+}
+
+func checkRelation(pass *analysis.Pass, field *ast.Field, name string, typ types.Type) {
+	target := deref(typ)
+	switch t := target.Underlying().(type) {
+	case *types.Slice:
+		target = deref(t.Elem())
+	case *types.Map:
+		target = deref(t.Elem())
+	}
+
+	if _, ok := target.Underlying().(*types.Struct); !ok {
+		pass.Reportf(field.Pos(), "fk: on %s of type %s, relations have to be structs or slices of structs", name, typ)
+		return
+	}
+
+	if named, ok := target.(*types.Named); !ok || !typesutil.IsTable(named) {
+		pass.Reportf(field.Pos(), "relation %s of type %s does not have jagger.BaseTable embedded", name, typ)
+	}
+}
+
+// the names of fields declaring pk:, descending into embed,
+// structs in chain are already being embedded and are skipped
+func pks(name string, typ types.Type, tag tags.JaggerTag, anonymous bool, chain map[*types.Struct]bool) []string {
+	if tag.PK {
+		return []string{name}
+	}
+	if !typesutil.IsEmbed(anonymous, typ, tag) {
+		return nil
+	}
+
+	st, ok := deref(typ).Underlying().(*types.Struct)
+	if !ok || chain[st] {
+		return nil
+	}
+
+	chain[st] = true
+	defer delete(chain, st)
+
+	var result []string
+	for i := range st.NumFields() {
+		field := st.Field(i)
+		fieldTag := tags.NewJaggerTagLenient(reflect.StructTag(st.Tag(i)))
+
+		if typesutil.IsBaseTable(field.Type()) {
+			continue
+		}
+
+		result = append(result, pks(name+"."+field.Name(), field.Type(), fieldTag, field.Anonymous(), chain)...)
+	}
+
+	return result
+}
+
+func fieldName(field *ast.Field) string {
+	if len(field.Names) != 0 {
+		return field.Names[0].Name
+	}
+
+	// embedded, the type name is the field name
+	typ := field.Type
+	if star, ok := typ.(*ast.StarExpr); ok {
+		typ = star.X
+	}
+	switch t := typ.(type) {
+	case *ast.Ident:
+		return t.Name
+	case *ast.SelectorExpr:
+		return t.Sel.Name
+	}
+
+	return "field"
+}
+
+func deref(typ types.Type) types.Type {
+	if ptr, ok := typ.(*types.Pointer); ok {
+		return ptr.Elem()
+	}
+
+	return typ
+}
@@ -0,0 +1,13 @@
+package jaggertags_test
+
+import (
+	"testing"
+
+	"golang.org/x/tools/go/analysis/analysistest"
+
+	"github.com/tronikelis/jagger/analysis/jaggertags"
+)
+
+func TestAnalyzer(t *testing.T) {
+	analysistest.Run(t, analysistest.TestData(), jaggertags.Analyzer, "a")
+}
@@ -0,0 +1,69 @@
+package a
+
+import "github.com/tronikelis/jagger"
+
+type User struct {
+	jagger.BaseTable `jagger:"users"`
+
+	ID    int    `jagger:"id,pk:" json:"id"`
+	Songs []Song `jagger:",fk:user_id" json:"songs"`
+}
+
+type Song struct {
+	jagger.BaseTable `jagger:"songs"`
+
+	ID     int   `jagger:"id,pkk:" json:"id"` // want `ID: invalid jagger tag option "pkk:": unknown key pkk`
+	UserID int   `jagger:"user_id"`           // want `UserID is missing a json tag name`
+	User   *User `jagger:",fk:user_id" json:"user"`
+	Name   int   `jagger:"-"`
+	Title  int   `jagger:"title,fk:a:b" json:"title"` // want `Title: invalid jagger tag option "fk:a:b": more than one value`
+}
+
+type Timestamps struct {
+	ID int `jagger:"id,pk:" json:"id"`
+}
+
+type TwoPks struct {
+	jagger.BaseTable `jagger:"two"`
+	Timestamps       `jagger:",embed:"`
+
+	Other int `jagger:"other,pk:" json:"other"` // want `Other declares pk: but Timestamps.ID already does`
+}
+
+type AnonymousPks struct {
+	jagger.BaseTable `jagger:"anonymous"`
+	Timestamps
+
+	Other int `jagger:"other,pk:" json:"other"` // want `Other declares pk: but Timestamps.ID already does`
+}
+
+type NotTable struct {
+	ID int `jagger:"id" json:"id"`
+}
+
+type BadRelations struct {
+	jagger.BaseTable `jagger:"bad"`
+
+	Count  int             `jagger:",fk:count_id" json:"count"`        // want `fk: on Count of type int, relations have to be structs or slices of structs`
+	Ids    []int           `jagger:",fk:ids" json:"ids"`               // want `fk: on Ids of type \[\]int, relations have to be structs or slices of structs`
+	Other  *NotTable       `jagger:",fk:other_id" json:"other"`        // want `relation Other of type \*a.NotTable does not have jagger.BaseTable embedded`
+	Others []NotTable      `jagger:",fk:bad_id" json:"others"`         // want `relation Others of type \[\]a.NotTable does not have jagger.BaseTable embedded`
+	Name   string          `jagger:",embed:" json:"name"`              // want `embed on Name of non-struct type string`
+	Zip    int             `jagger:",group" json:"zip"`                // want `group on Zip of non-struct type int`
+	Keyed  []Song          `jagger:",fk:bad_id,key:slug" json:"keyed"` // want `key: on Keyed of type \[\]a.Song, only map relations are keyed`
+	Songs  map[string]Song `jagger:",fk:bad_id" json:"songs"`          // want `map relation Songs is missing key:`
+	BySlug map[string]Song `jagger:",fk:bad_id,key:slug" json:"by_slug"`
+}
+
+// embeds itself without any jagger tags
+type List struct {
+	*List
+	V int
+}
+
+type Node struct {
+	jagger.BaseTable `jagger:"nodes"`
+	*Node
+
+	ID int `jagger:"id,pk:" json:"id"`
+}
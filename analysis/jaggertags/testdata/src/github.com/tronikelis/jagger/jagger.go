@@ -0,0 +1,5 @@
+package jagger
+
+type BaseTable struct{}
+
+func (BaseTable) jaggerTable() {}
@@ -0,0 +1,115 @@
+package jagger
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/tronikelis/jagger/relation"
+	"github.com/tronikelis/jagger/tags"
+)
+
+// Batch renders independent queries into one, {"key": <json of the query>},
+// use Envelope for paginated queries
+type Batch map[string]*QueryBuilder
+
+func (b Batch) ToSql() (string, []any, error) {
+	var args []any
+	var objects []string
+
+	for _, k := range slices.Sorted(maps.Keys(b)) {
+		qb := b[k]
+		if qb == nil {
+			return "", nil, fmt.Errorf("batch %s: %w, the builder is nil", k, ErrNoTarget)
+		}
+
+		// the cursor column can not be returned from a scalar sub query
+		if qb.page != nil && !qb.envelope {
+			return "", nil, fmt.Errorf("%w, %s has to use Envelope to paginate in a batch", ErrInvalidPage, k)
+		}
+
+		sql, qbArgs, err := qb.ToSql()
+		if err != nil {
+			return "", nil, fmt.Errorf("batch %s: %w", k, err)
+		}
+
+		sql, err = relation.IncrementArgs(sql, len(args))
+		if err != nil {
+			return "", nil, fmt.Errorf("batch %s: %w", k, err)
+		}
+		args = append(args, qbArgs...)
+
+		objects = append(objects, fmt.Sprintf("'%s', (%s)", strings.ReplaceAll(k, "'", "''"), sql))
+	}
+
+	return fmt.Sprintf("select json_build_object(%s)", strings.Join(objects, ", ")), args, nil
+}
+
+// calls .ToSql and panics if error
+func (b Batch) MustSql() (string, []any) {
+	sql, args, err := b.ToSql()
+	if err != nil {
+		panic(err)
+	}
+
+	return sql, args
+}
+
+// unmarshals the json returned by postgres into dest,
+// a pointer to a struct has to have a json field for every key,
+// every key is unmarshaled by its builder
+func (b Batch) Unmarshal(data []byte, dest any) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return json.Unmarshal(data, dest)
+	}
+	v = v.Elem()
+
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(data, &values); err != nil {
+		return err
+	}
+
+	for _, k := range slices.Sorted(maps.Keys(b)) {
+		field, ok := jsonField(v, k)
+		if !ok {
+			return fmt.Errorf("batch key %s has no json field in %v", k, v.Type())
+		}
+
+		raw, ok := values[k]
+		if !ok {
+			continue
+		}
+
+		if b[k] == nil {
+			return fmt.Errorf("batch %s: %w, the builder is nil", k, ErrNoTarget)
+		}
+
+		if err := b[k].Unmarshal(raw, field.Addr().Interface()); err != nil {
+			return fmt.Errorf("batch %s: %w", k, err)
+		}
+	}
+
+	return nil
+}
+
+// returns the field of the struct v which is named name in json
+func jsonField(v reflect.Value, name string) (reflect.Value, bool) {
+	for i := range v.NumField() {
+		field := v.Type().Field(i)
+
+		jsonName := tags.ParseSliceTag(field.Tag.Get("json"))[0]
+		if jsonName == "" {
+			jsonName = field.Name
+		}
+
+		if strings.EqualFold(jsonName, name) {
+			return v.Field(i), true
+		}
+	}
+
+	return reflect.Value{}, false
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"go/types"
+	pathpkg "path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tronikelis/jagger/internal/typesutil"
+	"github.com/tronikelis/jagger/tags"
+)
+
+type pkg struct {
+	dir   string
+	fset  *token.FileSet
+	types *types.Package
+}
+
+func load(patterns []string, output string) ([]pkg, error) {
+	loaded, err := typesutil.Load(patterns...)
+	if err != nil {
+		return nil, err
+	}
+
+	var pkgs []pkg
+	for _, p := range loaded {
+		for _, err := range p.Errors {
+			// a stale generated file should not stop regenerating it
+			if strings.HasPrefix(filepath.Base(err.Pos), output+":") {
+				continue
+			}
+			return nil, err
+		}
+
+		if len(p.GoFiles) == 0 {
+			continue
+		}
+
+		pkgs = append(pkgs, pkg{dir: filepath.Dir(p.GoFiles[0]), fset: p.Fset, types: p.Types})
+	}
+
+	return pkgs, nil
+}
+
+type generator struct {
+	pkg     *types.Package
+	buf     bytes.Buffer
+	imports map[string]string
+}
+
+// returns nil if the package does not have any tables
+func generate(p pkg) ([]byte, error) {
+	g := &generator{pkg: p.types, imports: map[string]string{}}
+
+	tables := typesutil.Tables(g.pkg)
+	if len(tables) == 0 {
+		return nil, nil
+	}
+
+	registered := map[*types.Named]bool{}
+	var register []*types.Named
+
+	var walk func(named *types.Named) error
+	walk = func(named *types.Named) error {
+		if registered[named] {
+			return nil
+		}
+		registered[named] = true
+		register = append(register, named)
+
+		st := named.Underlying().(*types.Struct)
+		for i := range st.NumFields() {
+			tag, err := tags.NewJaggerTag(reflect.StructTag(st.Tag(i)))
+			if err != nil {
+				return fmt.Errorf("%s: %s.%s: %w", p.fset.Position(st.Field(i).Pos()), named.Obj().Name(), st.Field(i).Name(), err)
+			}
+			if !typesutil.IsEmbed(st.Field(i).Anonymous(), st.Field(i).Type(), tag) {
+				continue
+			}
+
+			if embedded := g.localStruct(st.Field(i).Type()); embedded != nil {
+				if err := walk(embedded); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	}
+	for _, t := range tables {
+		if err := walk(t); err != nil {
+			return nil, err
+		}
+	}
+
+	g.printf("func init() {\n")
+	for _, named := range register {
+		g.register(named)
+	}
+	g.printf("}\n\n")
+
+	isTable := map[*types.Named]bool{}
+	for _, t := range tables {
+		isTable[t] = true
+	}
+	for _, t := range tables {
+		g.paths(t, isTable)
+	}
+
+	header := bytes.Buffer{}
+	fmt.Fprintf(&header, "// Code generated by jagger-gen. DO NOT EDIT.\n\npackage %s\n\n", g.pkg.Name())
+
+	paths := make([]string, 0, len(g.imports))
+	for path := range g.imports {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	header.WriteString("import (\n")
+	for _, path := range paths {
+		if alias := g.imports[path]; alias != pathpkg.Base(path) {
+			fmt.Fprintf(&header, "%s ", alias)
+		}
+		fmt.Fprintf(&header, "%q\n", path)
+	}
+	header.WriteString(")\n\n")
+
+	header.Write(g.buf.Bytes())
+
+	src, err := format.Source(header.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting generated code: %w", err)
+	}
+
+	return src, nil
+}
+
+func (g *generator) printf(format string, args ...any) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+// returns the package name used for path, importing it
+func (g *generator) use(path string, name string) string {
+	if existing, ok := g.imports[path]; ok {
+		return existing
+	}
+
+	taken := map[string]bool{}
+	for _, n := range g.imports {
+		taken[n] = true
+	}
+
+	alias := name
+	for i := 2; taken[alias] || g.pkg.Scope().Lookup(alias) != nil; i++ {
+		alias = name + strconv.Itoa(i)
+	}
+
+	g.imports[path] = alias
+	return alias
+}
+
+func (g *generator) qualifier(p *types.Package) string {
+	if p == g.pkg {
+		return ""
+	}
+
+	return g.use(p.Path(), p.Name())
+}
+
+func (g *generator) typeString(typ types.Type) string {
+	return types.TypeString(typ, g.qualifier)
+}
+
+// returns the named struct in this package behind typ,
+// pointers and slices are dereferenced
+func (g *generator) localStruct(typ types.Type) *types.Named {
+	named, _ := typesutil.Struct(typ)
+	if named == nil || named.Obj().Pkg() != g.pkg {
+		return nil
+	}
+
+	return named
+}
+
+// parses a tag of a struct which was already validated by walk
+func jaggerTag(tag string) tags.JaggerTag {
+	return tags.NewJaggerTagLenient(reflect.StructTag(tag))
+}
+
+func (g *generator) register(named *types.Named) {
+	jagger := g.use(typesutil.JaggerPath, "jagger")
+	tagsPkg := g.use(typesutil.JaggerPath+"/tags", "tags")
+	reflectPkg := g.use("reflect", "reflect")
+
+	g.printf("%s.RegisterTable[%s](\n", jagger, g.typeString(named))
+
+	st := named.Underlying().(*types.Struct)
+	for i := range st.NumFields() {
+		field := st.Field(i)
+		rawTag := st.Tag(i)
+		tag := jaggerTag(rawTag)
+
+		// %#v prints the package as tags, it may be imported as something else
+		literal := fmt.Sprintf("%#v", tag)
+		literal = tagsPkg + literal[len("tags"):]
+
+		g.printf("%s.FieldMeta{Name: %q, Index: %d, Anonymous: %t, Type: %s.TypeFor[%s](), Tag: %#q, Jagger: %s},\n",
+			jagger, field.Name(), i, field.Anonymous(), reflectPkg, g.typeString(field.Type()), rawTag, literal)
+	}
+
+	g.printf(")\n")
+}
+
+type pathField struct {
+	name   string
+	target *types.Named
+}
+
+// relation fields of named, including ones promoted by embed,
+// structs in chain are already being embedded and are skipped
+func (g *generator) relations(named *types.Named, chain map[*types.Named]bool) []pathField {
+	var fields []pathField
+
+	chain[named] = true
+	defer delete(chain, named)
+
+	st := named.Underlying().(*types.Struct)
+	for i := range st.NumFields() {
+		field := st.Field(i)
+		tag := jaggerTag(st.Tag(i))
+
+		if typesutil.IsEmbed(field.Anonymous(), field.Type(), tag) {
+			// groups and named embeds can not have relations
+			jsonName := tags.ParseSliceTag(reflect.StructTag(st.Tag(i)).Get("json"))[0]
+			nested := tag.Group || !field.Anonymous() || jsonName != ""
+			if embedded := g.localStruct(field.Type()); embedded != nil && !nested && !chain[embedded] {
+				fields = append(fields, g.relations(embedded, chain)...)
+			}
+			continue
+		}
+
+		if tag.FK == "" {
+			continue
+		}
+
+		if target := g.localStruct(field.Type()); target != nil {
+			fields = append(fields, pathField{name: field.Name(), target: target})
+		}
+	}
+
+	return fields
+}
+
+func (g *generator) paths(named *types.Named, isTable map[*types.Named]bool) {
+	jagger := g.use(typesutil.JaggerPath, "jagger")
+	name := named.Obj().Name()
+
+	g.printf("// %sPath is a join path starting from %s\n", name, name)
+	g.printf("type %sPath string\n\n", name)
+	g.printf("// %sPaths is the root of join paths starting from %s\n", name, name)
+	g.printf("const %sPaths %sPath = \"\"\n\n", name, name)
+	g.printf("func (p %sPath) String() string { return string(p) }\n\n", name)
+
+	for _, f := range g.relations(named, map[*types.Named]bool{}) {
+		if !isTable[f.target] {
+			continue
+		}
+
+		target := f.target.Obj().Name()
+		g.printf("func (p %sPath) %s() %sPath { return %sPath(%s.JoinPath(string(p), %q)) }\n\n",
+			name, f.name, target, target, jagger, f.name)
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerate(t *testing.T) {
+	t.Parallel()
+
+	pkgs, err := load([]string{"./testdata/example"}, "jagger_gen.go")
+	assert.NoError(t, err)
+	assert.Len(t, pkgs, 1)
+
+	src, err := generate(pkgs[0])
+	assert.NoError(t, err)
+
+	out := string(src)
+	assert.Contains(t, out, "package example")
+	assert.Contains(t, out, "jagger.RegisterTable[User](")
+	assert.Contains(t, out, "jagger.RegisterTable[Timestamps](")
+	assert.Contains(t, out, `Type: reflect.TypeFor[time.Time]()`)
+	assert.Contains(t, out, `Jagger: tags.JaggerTag{Name: "id", PK: true, FK: "", Embed: false, Cast: "", Encode: "", Prefix: "", Group: false, Key: ""}`)
+	assert.Contains(t, out, `func (p UserPath) Songs() SongPath { return SongPath(jagger.JoinPath(string(p), "Songs")) }`)
+	assert.Contains(t, out, `func (p SongPath) User() UserPath { return UserPath(jagger.JoinPath(string(p), "User")) }`)
+	assert.NotContains(t, out, "TimestampsPath")
+	assert.Contains(t, out, `func (p NodePath) Parent() NodePath { return NodePath(jagger.JoinPath(string(p), "Parent")) }`)
+}
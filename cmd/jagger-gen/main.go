@@ -0,0 +1,52 @@
+// jagger-gen generates join path builders and precomputed table metadata
+// for every struct that has jagger.BaseTable embedded
+//
+// usage:
+//
+//	//go:generate go run github.com/tronikelis/jagger/cmd/jagger-gen
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+func main() {
+	output := flag.String("o", "jagger_gen.go", "output file name, written next to the package sources")
+	flag.Parse()
+
+	patterns := flag.Args()
+	if len(patterns) == 0 {
+		patterns = []string{"."}
+	}
+
+	if err := run(patterns, *output); err != nil {
+		fmt.Fprintf(os.Stderr, "jagger-gen: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(patterns []string, output string) error {
+	pkgs, err := load(patterns, output)
+	if err != nil {
+		return err
+	}
+
+	for _, pkg := range pkgs {
+		src, err := generate(pkg)
+		if err != nil {
+			return err
+		}
+		if src == nil {
+			continue
+		}
+
+		if err := os.WriteFile(filepath.Join(pkg.dir, output), src, 0o644); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
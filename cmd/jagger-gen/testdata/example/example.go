@@ -0,0 +1,37 @@
+package example
+
+import (
+	"time"
+
+	"github.com/tronikelis/jagger"
+)
+
+type User struct {
+	jagger.BaseTable `jagger:"users"`
+
+	ID    int    `jagger:"id,pk:" json:"id"`
+	Songs []Song `jagger:",fk:user_id" json:"songs"`
+}
+
+type Timestamps struct {
+	CreatedAt time.Time `jagger:"created_at" json:"created_at"`
+}
+
+type Song struct {
+	jagger.BaseTable `jagger:"songs"`
+	Timestamps       `jagger:",embed:"`
+
+	ID     int   `jagger:"id,pk:" json:"id"`
+	UserID int   `jagger:"user_id" json:"user_id"`
+	User   *User `jagger:",fk:user_id" json:"user"`
+}
+
+// embeds itself, which is not flattened again
+type Node struct {
+	jagger.BaseTable `jagger:"nodes"`
+	*Node
+
+	ID       int   `jagger:"id,pk:" json:"id"`
+	ParentID int   `jagger:"parent_id" json:"parent_id"`
+	Parent   *Node `jagger:",fk:parent_id" json:"parent"`
+}
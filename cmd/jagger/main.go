@@ -0,0 +1,52 @@
+// jagger is a command line tool for working with jagger structs and postgres schemas
+//
+// usage:
+//
+//	jagger structs [-pkg name] [-o file] schema.sql
+//	jagger vet -schema schema.sql [packages]
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands = []command{
+	{name: "structs", usage: "generate jagger structs from a schema dump", run: runStructs},
+	{name: "vet", usage: "check jagger structs against a schema dump", run: runVet},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: jagger <command> [arguments]\n\ncommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", c.name, c.usage)
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	for _, c := range commands {
+		if c.name != os.Args[1] {
+			continue
+		}
+
+		if err := c.run(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "jagger %s: %v\n", c.name, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	usage()
+	os.Exit(2)
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/tronikelis/jagger/schema"
+)
+
+func runStructs(args []string) error {
+	flags := flag.NewFlagSet("structs", flag.ContinueOnError)
+	pkg := flags.String("pkg", "models", "package name of the generated file")
+	output := flags.String("o", "", "output file, stdout if empty")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("expected a single schema file")
+	}
+
+	s, err := schema.ParseFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	src, warnings, err := generateStructs(s, *pkg)
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", w)
+	}
+	if err != nil {
+		return err
+	}
+
+	if *output == "" {
+		_, err := os.Stdout.Write(src)
+		return err
+	}
+
+	return os.WriteFile(*output, src, 0o644)
+}
+
+type structField struct {
+	name   string
+	typ    string
+	jagger string
+	json   string
+}
+
+type structDef struct {
+	table  *schema.Table
+	name   string
+	fields []structField
+
+	names map[string]bool
+	jsons map[string]bool
+}
+
+// adds a field, suffixing its names with a number on collisions
+func (s *structDef) add(f structField) {
+	name, json := f.name, f.json
+	for i := 2; s.names[f.name] || s.jsons[f.json]; i++ {
+		f.name = name + strconv.Itoa(i)
+		f.json = json + "_" + strconv.Itoa(i)
+	}
+
+	s.names[f.name] = true
+	s.jsons[f.json] = true
+	s.fields = append(s.fields, f)
+}
+
+type structsGenerator struct {
+	schema  *schema.Schema
+	structs []*structDef
+	byTable map[*schema.Table]*structDef
+	imports map[string]bool
+
+	warnings []string
+}
+
+func generateStructs(s *schema.Schema, pkg string) ([]byte, []string, error) {
+	g := &structsGenerator{
+		schema:  s,
+		byTable: map[*schema.Table]*structDef{},
+		imports: map[string]bool{"github.com/tronikelis/jagger": true},
+	}
+
+	typeNames := map[string]bool{}
+	for _, t := range s.Tables {
+		name := goName(singular(t.Name))
+		for i := 2; typeNames[name]; i++ {
+			name = goName(singular(t.Name)) + strconv.Itoa(i)
+		}
+		typeNames[name] = true
+
+		def := &structDef{table: t, name: name, names: map[string]bool{}, jsons: map[string]bool{}}
+		g.structs = append(g.structs, def)
+		g.byTable[t] = def
+
+		for _, c := range t.Columns {
+			g.column(def, c)
+		}
+	}
+
+	for _, def := range g.structs {
+		g.relations(def)
+	}
+
+	buf := bytes.Buffer{}
+	fmt.Fprintf(&buf, "// Code generated by jagger structs. DO NOT EDIT.\n\npackage %s\n\n", pkg)
+
+	imports := make([]string, 0, len(g.imports))
+	for imp := range g.imports {
+		imports = append(imports, imp)
+	}
+	sort.Slice(imports, func(i, j int) bool {
+		if isStd(imports[i]) != isStd(imports[j]) {
+			return isStd(imports[i])
+		}
+		return imports[i] < imports[j]
+	})
+
+	buf.WriteString("import (\n")
+	for i, imp := range imports {
+		// standard library first
+		if i > 0 && isStd(imports[i-1]) != isStd(imp) {
+			buf.WriteString("\n")
+		}
+		fmt.Fprintf(&buf, "%q\n", imp)
+	}
+	buf.WriteString(")\n")
+
+	for _, def := range g.structs {
+		fmt.Fprintf(&buf, "\ntype %s struct {\n", def.name)
+		fmt.Fprintf(&buf, "jagger.BaseTable `jagger:%q`\n\n", def.table.Name)
+		for _, f := range def.fields {
+			fmt.Fprintf(&buf, "%s %s `jagger:%q json:%q`\n", f.name, f.typ, f.jagger, f.json)
+		}
+		buf.WriteString("}\n")
+	}
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, g.warnings, err
+	}
+
+	return src, g.warnings, nil
+}
+
+func isStd(path string) bool {
+	first, _, _ := strings.Cut(path, "/")
+	return !strings.Contains(first, ".")
+}
+
+func (g *structsGenerator) warnf(format string, args ...any) {
+	g.warnings = append(g.warnings, fmt.Sprintf(format, args...))
+}
+
+func (g *structsGenerator) column(def *structDef, c *schema.Column) {
+	jaggerTag := c.Name
+	if len(def.table.PrimaryKey) == 1 && def.table.PrimaryKey[0] == c.Name {
+		jaggerTag += ",pk:"
+	}
+
+	def.add(structField{
+		name:   goName(c.Name),
+		typ:    g.goType(c),
+		jagger: jaggerTag,
+		json:   c.Name,
+	})
+}
+
+func (g *structsGenerator) relations(def *structDef) {
+	t := def.table
+
+	// how many keys point from this table to each parent, more than one needs longer names
+	counts := map[*schema.Table]int{}
+	for _, fk := range t.ForeignKeys {
+		counts[g.schema.Table(qualified(fk.RefSchema, fk.RefTable))]++
+	}
+
+	for _, fk := range t.ForeignKeys {
+		parent := g.schema.Table(qualified(fk.RefSchema, fk.RefTable))
+		if parent == nil {
+			g.warnf("%s: %s references unknown table %s, skipping", fk.Pos, t.Name, fk.RefTable)
+			continue
+		}
+
+		if len(fk.Columns) != 1 {
+			g.warnf("%s: composite foreign key on %s is not supported, skipping", fk.Pos, t.Name)
+			continue
+		}
+
+		refColumns := fk.RefColumns
+		if refColumns == nil {
+			refColumns = parent.PrimaryKey
+		}
+		if len(parent.PrimaryKey) != 1 || len(refColumns) != 1 || refColumns[0] != parent.PrimaryKey[0] {
+			g.warnf("%s: %s.%s does not reference the primary key of %s, skipping", fk.Pos, t.Name, fk.Columns[0], parent.Name)
+			continue
+		}
+
+		col := fk.Columns[0]
+		parentDef := g.byTable[parent]
+
+		// songs.user_id -> Song.User
+		oneJson := strings.TrimSuffix(col, "_id")
+		if oneJson == col || oneJson == "" {
+			oneJson = singular(parent.Name)
+		}
+		def.add(structField{
+			name:   goName(oneJson),
+			typ:    "*" + parentDef.name,
+			jagger: ",fk:" + col,
+			json:   oneJson,
+		})
+
+		// users <- songs.user_id -> User.Songs
+		manyJson := t.Name
+		if counts[parent] > 1 {
+			manyJson += "_by_" + col
+		}
+		parentDef.add(structField{
+			name:   goName(manyJson),
+			typ:    "[]" + def.name,
+			jagger: ",fk:" + col,
+			json:   manyJson,
+		})
+	}
+}
+
+func qualified(schema string, table string) string {
+	if schema == "" {
+		return table
+	}
+
+	return schema + "." + table
+}
+
+func (g *structsGenerator) goType(c *schema.Column) string {
+	typ := c.Type
+	array := strings.HasSuffix(typ, "[]")
+	typ = strings.TrimSuffix(typ, "[]")
+	if i := strings.IndexByte(typ, '('); i != -1 {
+		typ = strings.TrimSpace(typ[:i]) + typ[strings.IndexByte(typ, ')')+1:]
+	}
+
+	var goTyp string
+	nullable := !c.NotNull
+
+	switch typ {
+	case "smallint", "int2", "smallserial", "serial2":
+		goTyp = "int16"
+	case "integer", "int", "int4", "serial", "serial4":
+		goTyp = "int32"
+	case "bigint", "int8", "bigserial", "serial8":
+		goTyp = "int64"
+	case "real", "float4":
+		goTyp = "float32"
+	case "double precision", "float8", "float":
+		goTyp = "float64"
+	case "numeric", "decimal", "money":
+		g.imports["encoding/json"] = true
+		goTyp = "json.Number"
+	case "boolean", "bool":
+		goTyp = "bool"
+	case "text", "character varying", "varchar", "character", "char", "citext", "uuid",
+		"time", "time without time zone", "time with time zone", "timetz", "interval", "inet", "cidr":
+		goTyp = "string"
+	case "timestamp", "timestamp without time zone", "timestamp with time zone", "timestamptz", "date":
+		g.imports["time"] = true
+		goTyp = "time.Time"
+	case "bytea":
+		goTyp = "[]byte"
+		nullable = false
+	default:
+		// json, jsonb, enums and everything else is kept as raw json
+		g.imports["encoding/json"] = true
+		goTyp = "json.RawMessage"
+		nullable = false
+	}
+
+	if array {
+		return "[]" + goTyp
+	}
+	if nullable {
+		return "*" + goTyp
+	}
+
+	return goTyp
+}
+
+var initialisms = map[string]string{
+	"id": "ID", "url": "URL", "uuid": "UUID", "json": "JSON", "api": "API",
+	"http": "HTTP", "ip": "IP", "sql": "SQL", "html": "HTML",
+}
+
+// user_id -> UserID
+func goName(name string) string {
+	builder := strings.Builder{}
+
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, word := range words {
+		if initialism, ok := initialisms[strings.ToLower(word)]; ok {
+			builder.WriteString(initialism)
+			continue
+		}
+
+		runes := []rune(word)
+		runes[0] = unicode.ToUpper(runes[0])
+		builder.WriteString(string(runes))
+	}
+
+	result := builder.String()
+	if result == "" || !unicode.IsLetter([]rune(result)[0]) {
+		result = "X" + result
+	}
+
+	return result
+}
+
+// a naive english singular, users -> user, categories -> category
+func singular(name string) string {
+	switch {
+	case strings.HasSuffix(name, "ies") && len(name) > 3:
+		return name[:len(name)-3] + "y"
+	case strings.HasSuffix(name, "sses"), strings.HasSuffix(name, "shes"),
+		strings.HasSuffix(name, "ches"), strings.HasSuffix(name, "xes"):
+		return name[:len(name)-2]
+	case strings.HasSuffix(name, "ss"), strings.HasSuffix(name, "us"):
+		return name
+	case strings.HasSuffix(name, "s") && len(name) > 1:
+		return name[:len(name)-1]
+	}
+
+	return name
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tronikelis/jagger/schema"
+)
+
+func TestGenerateStructs(t *testing.T) {
+	t.Parallel()
+
+	s, err := schema.Parse("schema.sql", `
+create table users (id bigint primary key, name text not null, avatar bytea);
+create table categories (id int primary key, parent_id int references categories (id));
+create table songs (
+	id int primary key,
+	author_id bigint not null references users,
+	editor_id bigint references users (id),
+	created_at timestamptz not null,
+	meta jsonb,
+	unknown_id int references nope (id)
+);
+`)
+	assert.NoError(t, err)
+
+	src, warnings, err := generateStructs(s, "models")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"schema.sql:10:17: songs references unknown table nope, skipping"}, warnings)
+
+	out := string(src)
+	assert.Contains(t, out, "package models")
+	assert.Contains(t, out, "type User struct {\n\tjagger.BaseTable `jagger:\"users\"`\n")
+	assert.Contains(t, out, "ID              int64  `jagger:\"id,pk:\" json:\"id\"`")
+	assert.Contains(t, out, "Avatar          []byte `jagger:\"avatar\" json:\"avatar\"`")
+	assert.Contains(t, out, "SongsByAuthorID []Song `jagger:\",fk:author_id\" json:\"songs_by_author_id\"`")
+	assert.Contains(t, out, "SongsByEditorID []Song `jagger:\",fk:editor_id\" json:\"songs_by_editor_id\"`")
+	assert.Contains(t, out, "type Category struct {")
+	assert.Contains(t, out, "Parent     *Category  `jagger:\",fk:parent_id\" json:\"parent\"`")
+	assert.Contains(t, out, "Categories []Category `jagger:\",fk:parent_id\" json:\"categories\"`")
+	assert.Contains(t, out, "Author    *User           `jagger:\",fk:author_id\" json:\"author\"`")
+	assert.Contains(t, out, "CreatedAt time.Time       `jagger:\"created_at\" json:\"created_at\"`")
+	assert.Contains(t, out, "Meta      json.RawMessage `jagger:\"meta\" json:\"meta\"`")
+}
@@ -0,0 +1,70 @@
+package vet
+
+import "github.com/tronikelis/jagger"
+
+type User struct {
+	jagger.BaseTable `jagger:"users"`
+
+	ID    int     `jagger:"id,pk:" json:"id"`
+	Email string  `jagger:"email" json:"email"`
+	Songs []Song  `jagger:",fk:user_id" json:"songs"`
+	Home  Address `jagger:",embed,prefix:home_" json:"home"`
+}
+
+type Song struct {
+	jagger.BaseTable `jagger:"songs"`
+
+	ID     int   `jagger:"id,pk:" json:"id"`
+	UserID int   `jagger:"user_id" json:"user_id"`
+	User   *User `jagger:",fk:user_id" json:"user"`
+}
+
+type Address struct {
+	City string `jagger:"city" json:"city"`
+}
+
+type Country struct {
+	jagger.BaseTable `jagger:"countries"`
+
+	ID int `jagger:"id,pk:" json:"id"`
+}
+
+type Located struct {
+	CountryID int      `jagger:"country_id" json:"country_id"`
+	Country   *Country `jagger:",fk:country_id" json:"country"`
+}
+
+type Shop struct {
+	jagger.BaseTable `jagger:"shops"`
+	Located          `jagger:",embed,prefix:billing_"`
+
+	ID int `jagger:"id,pk:" json:"id"`
+}
+
+type Timestamps struct {
+	CreatedAt string `jagger:"created_at" json:"created_at"`
+	UpdatedAt string `jagger:"updated_at" json:"updated_at"`
+}
+
+type Audit struct {
+	UpdatedAt string `jagger:"audit_updated_at" json:"updated_at"`
+}
+
+// updated_at of Timestamps and Audit hide each other
+type Post struct {
+	jagger.BaseTable `jagger:"posts"`
+	Timestamps
+	Audit
+
+	ID int `jagger:"id,pk:" json:"id"`
+}
+
+// embeds itself, which is not flattened again
+type Node struct {
+	jagger.BaseTable `jagger:"nodes"`
+	*Node
+
+	ID       int   `jagger:"id,pk:" json:"id"`
+	ParentID int   `jagger:"parent_id" json:"parent_id"`
+	Parent   *Node `jagger:",fk:parent_id" json:"parent"`
+}
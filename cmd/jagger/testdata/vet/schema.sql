@@ -0,0 +1,29 @@
+create table users (
+    id bigint primary key,
+    mail text,
+    home_city text
+);
+
+create table songs (
+    id bigint primary key,
+    user_id bigint not null
+);
+
+create table countries (
+    id bigint primary key
+);
+
+create table shops (
+    id bigint primary key,
+    billing_country_id bigint references countries (id)
+);
+
+create table posts (
+    id bigint primary key,
+    created_at timestamptz not null
+);
+
+create table nodes (
+    id bigint primary key,
+    parent_id bigint references nodes (id)
+);
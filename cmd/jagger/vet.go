@@ -0,0 +1,207 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/tronikelis/jagger/internal/dominance"
+	"github.com/tronikelis/jagger/internal/typesutil"
+	"github.com/tronikelis/jagger/schema"
+	"github.com/tronikelis/jagger/tags"
+)
+
+func runVet(args []string) error {
+	flags := flag.NewFlagSet("vet", flag.ContinueOnError)
+	schemaFile := flags.String("schema", "", "schema file to check against, for example pg_dump --schema-only output")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *schemaFile == "" {
+		return fmt.Errorf("-schema is required")
+	}
+
+	patterns := flags.Args()
+	if len(patterns) == 0 {
+		patterns = []string{"."}
+	}
+
+	issues, err := vet(*schemaFile, patterns)
+	if err != nil {
+		return err
+	}
+
+	for _, issue := range issues {
+		fmt.Fprintln(os.Stderr, issue)
+	}
+	if len(issues) != 0 {
+		return fmt.Errorf("%d issues found", len(issues))
+	}
+
+	return nil
+}
+
+func vet(schemaFile string, patterns []string) ([]schema.Issue, error) {
+	s, err := schema.ParseFile(schemaFile)
+	if err != nil {
+		return nil, err
+	}
+
+	pkgs, err := typesutil.Load(patterns...)
+	if err != nil {
+		return nil, err
+	}
+
+	var mappings []*schema.Mapping
+	var issues []schema.Issue
+	for _, pkg := range pkgs {
+		for _, err := range pkg.Errors {
+			return nil, err
+		}
+
+		v := &vetter{fset: pkg.Fset, mappings: map[*types.Named]*schema.Mapping{}}
+		for _, named := range typesutil.Tables(pkg.Types) {
+			mappings = append(mappings, v.mapping(named))
+		}
+		issues = append(issues, v.issues...)
+	}
+
+	return append(issues, s.Check(mappings...)...), nil
+}
+
+type vetter struct {
+	fset     *token.FileSet
+	mappings map[*types.Named]*schema.Mapping
+	// tags which could not be parsed
+	issues []schema.Issue
+}
+
+func (v *vetter) pos(pos token.Pos) string {
+	position := v.fset.Position(pos)
+
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, position.Filename); err == nil {
+			position.Filename = rel
+		}
+	}
+
+	return position.String()
+}
+
+func (v *vetter) mapping(named *types.Named) *schema.Mapping {
+	if m, ok := v.mappings[named]; ok {
+		return m
+	}
+
+	m := &schema.Mapping{Type: named.Obj().Name(), Pos: v.pos(named.Obj().Pos())}
+	// stored before the fields so cyclic relations end here
+	v.mappings[named] = m
+
+	// fields hidden by the encoding/json rules are never selected
+	st := named.Underlying().(*types.Struct)
+	fields := v.fields(m, st, "", nil, map[*types.Struct]bool{st: true})
+	for _, f := range dominance.Fields(fields, func(f vetField) dominance.Field { return f.dominance }) {
+		m.Fields = append(m.Fields, f.MappedField)
+	}
+
+	return m
+}
+
+// a mapped field with what the encoding/json rules need
+type vetField struct {
+	*schema.MappedField
+	dominance dominance.Field
+}
+
+// prefix is prepended to the columns of embedded structs, parents are the json keys of the named
+// embeds and groups the fields are nested in and chain are the structs being embedded,
+// a struct can embed a pointer to itself
+func (v *vetter) fields(m *schema.Mapping, st *types.Struct, prefix string, parents []string, chain map[*types.Struct]bool) []vetField {
+	var fields []vetField
+	depth := len(chain) - 1
+
+	for i := range st.NumFields() {
+		field := st.Field(i)
+		tag, err := tags.NewJaggerTag(reflect.StructTag(st.Tag(i)))
+		if err != nil {
+			v.issues = append(v.issues, schema.Issue{Pos: v.pos(field.Pos()), Message: fmt.Sprintf("%s.%s: %v", m.Type, field.Name(), err)})
+			continue
+		}
+
+		if typesutil.IsBaseTable(field.Type()) {
+			m.Table = tag.Name
+			continue
+		}
+
+		jsonName := tags.ParseSliceTag(reflect.StructTag(st.Tag(i)).Get("json"))[0]
+
+		if typesutil.IsEmbed(field.Anonymous(), field.Type(), tag) {
+			if _, embedded := typesutil.Struct(field.Type()); embedded != nil && !chain[embedded] {
+				nested := parents
+				if tag.Group || !field.Anonymous() || jsonName != "" {
+					name := jsonName
+					if name == "" {
+						name = field.Name()
+					}
+					nested = append(slices.Clone(parents), name)
+				}
+
+				chain[embedded] = true
+				fields = append(fields, v.fields(m, embedded, prefix+tag.Prefix, nested, chain)...)
+				delete(chain, embedded)
+			}
+			continue
+		}
+
+		if tag.Name == "-" || reflect.ValueOf(tag).IsZero() {
+			continue
+		}
+
+		f := &schema.MappedField{Name: field.Name(), Pos: v.pos(field.Pos()), Column: tag.Name, PK: tag.PK, FK: tag.FK}
+		if tag.FK == "" {
+			f.Column = prefix + tag.Name
+		}
+
+		if tag.FK != "" {
+			target, _ := typesutil.Struct(field.Type())
+			if target == nil {
+				continue
+			}
+
+			f.Target = v.mapping(target)
+
+			typ := field.Type()
+			if ptr, ok := typ.(*types.Pointer); ok {
+				typ = ptr.Elem()
+			}
+			switch typ.(type) {
+			case *types.Slice, *types.Map:
+				f.Many = true
+			}
+			// the fk of a one relation is a column of this table
+			if !f.Many {
+				f.FK = prefix + tag.FK
+			}
+		}
+
+		key := jsonName
+		if key == "" {
+			key = field.Name()
+		}
+
+		fields = append(fields, vetField{MappedField: f, dominance: dominance.Field{
+			Key:    strings.Join(append(slices.Clone(parents), key), "."),
+			Depth:  depth + 1,
+			Tagged: jsonName != "",
+		}})
+	}
+
+	return fields
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tronikelis/jagger/schema"
+)
+
+func TestVet(t *testing.T) {
+	t.Parallel()
+
+	issues, err := vet("testdata/vet/schema.sql", []string{"./testdata/vet"})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []schema.Issue{
+		{Pos: "testdata/vet/models.go:9:2", Message: "User.Email: column email not found in table users"},
+		{Pos: "testdata/vet/models.go:10:2", Message: "User.Songs: missing foreign key songs(user_id) references users"},
+		{Pos: "testdata/vet/models.go:19:2", Message: "Song.User: missing foreign key songs(user_id) references users"},
+	}, issues)
+}
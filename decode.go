@@ -0,0 +1,227 @@
+package jagger
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/tronikelis/jagger/relation"
+)
+
+// unmarshals the json returned by postgres for this query into dest,
+// a pointer to a slice of the selected struct, or to a Page with Envelope,
+// the compact format is decoded by the position of the values
+func (qb *QueryBuilder) Unmarshal(data []byte, dest any) error {
+	if !qb.compact {
+		return json.Unmarshal(data, dest)
+	}
+
+	rel, err := qb.relation()
+	if err != nil {
+		return err
+	}
+
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Pointer || v.IsNil() {
+		return fmt.Errorf("Unmarshal needs a non nil pointer, got %T", dest)
+	}
+	v = v.Elem()
+
+	if !qb.envelope {
+		return decodeRows(rel, v, data)
+	}
+
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return err
+	}
+
+	rows := envelope["data"]
+	delete(envelope, "data")
+
+	// the rest of the metadata is plain json
+	metadata, err := json.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(metadata, dest); err != nil {
+		return err
+	}
+
+	if v.Kind() == reflect.Struct {
+		if field, ok := jsonField(v, "data"); ok {
+			return decodeRows(rel, field, rows)
+		}
+	}
+
+	return fmt.Errorf("Unmarshal needs a pointer to a struct with a data field for an envelope, got %T", dest)
+}
+
+// allocates nil pointers on the way
+func indirect(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+
+	return v
+}
+
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for _, i := range index {
+		v = indirect(v).Field(i)
+	}
+
+	return v
+}
+
+// decodes an array of rows into the slice v, or an object of them into the map v for keyed relations
+func decodeRows(rel relation.Relation, v reflect.Value, data json.RawMessage) error {
+	if rel.Key != "" {
+		return decodeKeyedRows(rel, v, data)
+	}
+
+	var rows []json.RawMessage
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return decodeError(rel, err)
+	}
+
+	v = indirect(v)
+	if v.Kind() != reflect.Slice {
+		return decodeError(rel, fmt.Errorf("expected a slice, got %v", v.Type()))
+	}
+
+	if rows == nil {
+		v.SetZero()
+		return nil
+	}
+
+	slice := reflect.MakeSlice(v.Type(), len(rows), len(rows))
+	for i, row := range rows {
+		if err := decodeRow(rel, slice.Index(i), row); err != nil {
+			return err
+		}
+	}
+	v.Set(slice)
+
+	return nil
+}
+
+// decodes an object of rows into the map v, the keys are converted like encoding/json does
+func decodeKeyedRows(rel relation.Relation, v reflect.Value, data json.RawMessage) error {
+	v = indirect(v)
+	if v.Kind() != reflect.Map {
+		return decodeError(rel, fmt.Errorf("expected a map, got %v", v.Type()))
+	}
+
+	rows := reflect.New(reflect.MapOf(v.Type().Key(), reflect.TypeFor[json.RawMessage]()))
+	if err := json.Unmarshal(data, rows.Interface()); err != nil {
+		return decodeError(rel, err)
+	}
+
+	if rows.Elem().IsNil() {
+		v.SetZero()
+		return nil
+	}
+
+	m := reflect.MakeMapWithSize(v.Type(), rows.Elem().Len())
+	iter := rows.Elem().MapRange()
+	for iter.Next() {
+		row := reflect.New(v.Type().Elem()).Elem()
+		if err := decodeRow(rel, row, iter.Value().Interface().(json.RawMessage)); err != nil {
+			return err
+		}
+		m.SetMapIndex(iter.Key(), row)
+	}
+	v.Set(m)
+
+	return nil
+}
+
+// decodes the array of values of one row into the struct v,
+// values are in the order of Fields, One and Many
+func decodeRow(rel relation.Relation, v reflect.Value, data json.RawMessage) error {
+	var values []json.RawMessage
+	if err := json.Unmarshal(data, &values); err != nil {
+		return decodeError(rel, err)
+	}
+
+	// a relation which was not found
+	if values == nil {
+		return nil
+	}
+
+	if expected := len(rel.Fields) + len(rel.One) + len(rel.Many); len(values) != expected {
+		return decodeError(rel, fmt.Errorf("expected %d values, got %d", expected, len(values)))
+	}
+
+	v = indirect(v)
+	i := 0
+
+	for _, f := range rel.Fields {
+		if err := decodeField(v, f, values[i]); err != nil {
+			return decodeError(rel, err)
+		}
+		i++
+	}
+
+	for _, o := range rel.One {
+		if err := decodeRow(o, fieldByIndex(v, o.Index), values[i]); err != nil {
+			return err
+		}
+		i++
+	}
+
+	for _, m := range rel.Many {
+		if err := decodeRows(m, fieldByIndex(v, m.Index), values[i]); err != nil {
+			return err
+		}
+		i++
+	}
+
+	return nil
+}
+
+// decodes a column or a group of them into the table struct v
+func decodeField(v reflect.Value, f relation.Field, data json.RawMessage) error {
+	if f.Fields == nil {
+		field := fieldByIndex(v, f.Index)
+		if err := json.Unmarshal(data, field.Addr().Interface()); err != nil {
+			return fmt.Errorf("%s: %w", f.Json, err)
+		}
+
+		return nil
+	}
+
+	var values []json.RawMessage
+	if err := json.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("%s: %w", f.Json, err)
+	}
+
+	if values == nil {
+		return nil
+	}
+
+	if len(values) != len(f.Fields) {
+		return fmt.Errorf("%s: expected %d values, got %d", f.Json, len(f.Fields), len(values))
+	}
+
+	for i, child := range f.Fields {
+		if err := decodeField(v, child, values[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func decodeError(rel relation.Relation, err error) error {
+	path := rel.Path
+	if path == "" {
+		path = "root"
+	}
+
+	return fmt.Errorf("decoding %s: %w", path, err)
+}
@@ -0,0 +1,124 @@
+package jagger
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/tronikelis/jagger/relation"
+)
+
+var (
+	ErrNoTarget        = errors.New("ToSql called without target")
+	ErrNotStruct       = errors.New("Passed type not struct")
+	ErrNoBaseTable     = errors.New("Passed type does not have BaseTable embedded")
+	ErrInvalidRelation = errors.New("Cant join")
+	ErrNotJoined       = errors.New("Relation not joined")
+	ErrInvalidNamed    = errors.New("Named params have to be a map[string]any or a struct")
+	ErrInvalidPage     = errors.New("Invalid pagination")
+	ErrInvalidCursor   = errors.New("Invalid cursor")
+	ErrJoinType        = errors.New("Conflicting join types")
+)
+
+// returned when a join path references a field which is not a relation
+type FieldNotFoundError struct {
+	// the full join path up to and including the missing field
+	Path string
+	// the struct the missing field was looked up in
+	Type reflect.Type
+	// the relation fields of Type
+	Valid []string
+	// the closest valid relation field, empty if none is close
+	Suggestion string
+}
+
+func (e *FieldNotFoundError) Error() string {
+	builder := strings.Builder{}
+	builder.WriteString(fmt.Sprintf("Field %s not found in %v", e.Path, e.Type))
+
+	if len(e.Valid) == 0 {
+		builder.WriteString(", it has no relations")
+	} else {
+		builder.WriteString(fmt.Sprintf(", valid relations: %s", strings.Join(e.Valid, ", ")))
+	}
+
+	if e.Suggestion != "" {
+		builder.WriteString(fmt.Sprintf(", did you mean %s?", e.Suggestion))
+	}
+
+	return builder.String()
+}
+
+func newFieldNotFoundError(path string, field string, table table) *FieldNotFoundError {
+	err := &FieldNotFoundError{Path: path, Type: table.typ}
+
+	for _, f := range table.fields {
+		if f.tag.FK != "" {
+			err.Valid = append(err.Valid, f.name)
+		}
+	}
+	sort.Strings(err.Valid)
+
+	best := len(field)/2 + 1
+	for _, valid := range err.Valid {
+		if strings.EqualFold(valid, field) {
+			err.Suggestion = valid
+			break
+		}
+
+		if d := distance(strings.ToLower(valid), strings.ToLower(field)); d < best {
+			best = d
+			err.Suggestion = valid
+		}
+	}
+
+	return err
+}
+
+// levenshtein distance between a and b
+func distance(a string, b string) int {
+	ar, br := []rune(a), []rune(b)
+
+	prev := make([]int, len(br)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := range ar {
+		curr := make([]int, len(br)+1)
+		curr[0] = i + 1
+
+		for j := range br {
+			cost := 1
+			if ar[i] == br[j] {
+				cost = 0
+			}
+
+			curr[j+1] = min(prev[j+1]+1, curr[j]+1, prev[j]+cost)
+		}
+
+		prev = curr
+	}
+
+	return prev[len(br)]
+}
+
+// returned when a struct has an invalid jagger tag
+type TagError struct {
+	Type  reflect.Type
+	Field string
+	Err   error
+}
+
+func (e *TagError) Error() string {
+	return fmt.Sprintf("%s.%s: %v", e.Type.Name(), e.Field, e.Err)
+}
+
+func (e *TagError) Unwrap() error {
+	return e.Err
+}
+
+// returned when a SubQuery fails, Path is empty for the root sub query
+type SubQueryError = relation.SubQueryError
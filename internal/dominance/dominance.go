@@ -0,0 +1,57 @@
+// Package dominance applies the encoding/json rules for fields promoted from embedded structs
+package dominance
+
+// Field describes a field for the dominance rules
+type Field struct {
+	// the json key, including the keys of the objects it is nested in
+	Key string
+	// the length of the index path from the outer struct
+	Depth int
+	// whether the json key comes from a json tag
+	Tagged bool
+}
+
+// drops the fields hidden by the encoding/json rules, of the fields with the same key
+// the shallowest wins, then the one with a json tag, otherwise none of them
+func Fields[T any](fields []T, describe func(T) Field) []T {
+	byKey := map[string][]Field{}
+	for _, f := range fields {
+		d := describe(f)
+		byKey[d.Key] = append(byKey[d.Key], d)
+	}
+
+	var result []T
+	for _, f := range fields {
+		d := describe(f)
+
+		same := byKey[d.Key]
+		if len(same) == 1 {
+			result = append(result, f)
+			continue
+		}
+
+		depth := d.Depth
+		for _, other := range same {
+			depth = min(depth, other.Depth)
+		}
+		if d.Depth != depth {
+			continue
+		}
+
+		var shallowest, tagged int
+		for _, other := range same {
+			if other.Depth == depth {
+				shallowest++
+				if other.Tagged {
+					tagged++
+				}
+			}
+		}
+
+		if shallowest == 1 || (tagged == 1 && d.Tagged) {
+			result = append(result, f)
+		}
+	}
+
+	return result
+}
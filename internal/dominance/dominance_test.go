@@ -0,0 +1,27 @@
+package dominance
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFields(t *testing.T) {
+	t.Parallel()
+
+	fields := []Field{
+		{Key: "id", Depth: 1, Tagged: true},
+		{Key: "id", Depth: 2, Tagged: true},
+		{Key: "updated_at", Depth: 2, Tagged: true},
+		{Key: "updated_at", Depth: 2, Tagged: true},
+		{Key: "Note", Depth: 2},
+		{Key: "Note", Depth: 2, Tagged: true},
+		{Key: "billing.id", Depth: 2, Tagged: true},
+	}
+
+	assert.Equal(t, []Field{
+		{Key: "id", Depth: 1, Tagged: true},
+		{Key: "Note", Depth: 2, Tagged: true},
+		{Key: "billing.id", Depth: 2, Tagged: true},
+	}, Fields(fields, func(f Field) Field { return f }))
+}
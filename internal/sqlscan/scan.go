@@ -0,0 +1,272 @@
+// Package sqlscan splits postgres sql into tokens,
+// concatenating the text of every token gives back the original input
+package sqlscan
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type Kind int
+
+const (
+	Whitespace Kind = iota
+	Comment
+	Ident
+	QuotedIdent
+	String
+	Number
+	// positional parameter, $1
+	Param
+	// any other single character
+	Punct
+)
+
+type Pos struct {
+	Offset int
+	Line   int
+	Col    int
+}
+
+func (p Pos) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Col)
+}
+
+type Token struct {
+	Kind Kind
+	Text string
+	Pos  Pos
+}
+
+// returns true if the token is an identifier or keyword equal to word,
+// compared case insensitively like postgres does for unquoted identifiers
+func (t Token) Is(word string) bool {
+	return t.Kind == Ident && strings.EqualFold(t.Text, word)
+}
+
+// the identifier value, unquoted identifiers are folded to lower case
+func (t Token) Value() string {
+	switch t.Kind {
+	case Ident:
+		return strings.ToLower(t.Text)
+	case QuotedIdent:
+		return strings.ReplaceAll(t.Text[1:len(t.Text)-1], `""`, `"`)
+	}
+
+	return t.Text
+}
+
+type scanner struct {
+	src    string
+	offset int
+	line   int
+	col    int
+}
+
+func (s *scanner) pos() Pos {
+	return Pos{Offset: s.offset, Line: s.line, Col: s.col}
+}
+
+func (s *scanner) peek(n int) byte {
+	if s.offset+n >= len(s.src) {
+		return 0
+	}
+
+	return s.src[s.offset+n]
+}
+
+func (s *scanner) advance(n int) {
+	for _, r := range s.src[s.offset : s.offset+n] {
+		if r == '\n' {
+			s.line++
+			s.col = 1
+		} else {
+			s.col++
+		}
+	}
+
+	s.offset += n
+}
+
+func isIdentStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
+
+func isIdentPart(r rune) bool {
+	return isIdentStart(r) || r == '$' || unicode.IsDigit(r)
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+// splits src into tokens, the only errors are unterminated strings,
+// quoted identifiers and comments
+func Tokenize(src string) ([]Token, error) {
+	s := &scanner{src: src, line: 1, col: 1}
+	var tokens []Token
+
+	for s.offset < len(src) {
+		start := s.pos()
+
+		kind, n, err := s.next()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", start, err)
+		}
+
+		tokens = append(tokens, Token{Kind: kind, Text: src[s.offset : s.offset+n], Pos: start})
+		s.advance(n)
+	}
+
+	return tokens, nil
+}
+
+// returns the kind and byte length of the token at the current offset
+func (s *scanner) next() (Kind, int, error) {
+	rest := s.src[s.offset:]
+	r, size := utf8.DecodeRuneInString(rest)
+
+	switch {
+	case unicode.IsSpace(r):
+		n := strings.IndexFunc(rest, func(r rune) bool { return !unicode.IsSpace(r) })
+		if n == -1 {
+			n = len(rest)
+		}
+		return Whitespace, n, nil
+
+	case strings.HasPrefix(rest, "--"):
+		n := strings.IndexByte(rest, '\n')
+		if n == -1 {
+			n = len(rest)
+		}
+		return Comment, n, nil
+
+	case strings.HasPrefix(rest, "/*"):
+		n, err := blockComment(rest)
+		return Comment, n, err
+
+	case r == '\'':
+		n, err := quoted(rest, '\'', false)
+		return String, n, err
+
+	case (r == 'e' || r == 'E') && s.peek(1) == '\'':
+		n, err := quoted(rest[1:], '\'', true)
+		return String, n + 1, err
+
+	case r == '"':
+		n, err := quoted(rest, '"', false)
+		return QuotedIdent, n, err
+
+	case r == '$':
+		if isDigit(s.peek(1)) {
+			n := 1
+			for n < len(rest) && isDigit(rest[n]) {
+				n++
+			}
+			return Param, n, nil
+		}
+
+		if tag, ok := dollarTag(rest); ok {
+			end := strings.Index(rest[len(tag):], tag)
+			if end == -1 {
+				return 0, 0, fmt.Errorf("unterminated dollar-quoted string")
+			}
+			return String, len(tag) + end + len(tag), nil
+		}
+
+		return Punct, 1, nil
+
+	case isIdentStart(r):
+		n := strings.IndexFunc(rest, func(r rune) bool { return !isIdentPart(r) })
+		if n == -1 {
+			n = len(rest)
+		}
+		return Ident, n, nil
+
+	case (r < utf8.RuneSelf && isDigit(byte(r))) || (r == '.' && isDigit(s.peek(1))):
+		return Number, number(rest), nil
+	}
+
+	return Punct, size, nil
+}
+
+// returns the length of a possibly nested block comment
+func blockComment(src string) (int, error) {
+	depth := 0
+
+	for i := 0; i < len(src)-1; i++ {
+		switch src[i : i+2] {
+		case "/*":
+			depth++
+			i++
+		case "*/":
+			depth--
+			i++
+			if depth == 0 {
+				return i + 1, nil
+			}
+		}
+	}
+
+	return 0, fmt.Errorf("unterminated block comment")
+}
+
+// returns the length of a string quoted by quote, doubled quotes are escapes,
+// backslash escapes are only recognized if backslash is set
+func quoted(src string, quote byte, backslash bool) (int, error) {
+	for i := 1; i < len(src); i++ {
+		switch src[i] {
+		case '\\':
+			if backslash {
+				i++
+			}
+		case quote:
+			if i+1 < len(src) && src[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unterminated %c quote", quote)
+}
+
+// returns the opening tag of a dollar-quoted string, $$ or $tag$
+func dollarTag(src string) (string, bool) {
+	for i, r := range src[1:] {
+		if r == '$' {
+			return src[:i+2], true
+		}
+
+		if !isIdentPart(r) || (i == 0 && !isIdentStart(r)) {
+			return "", false
+		}
+	}
+
+	return "", false
+}
+
+func number(src string) int {
+	n := 0
+	for n < len(src) && (isDigit(src[n]) || src[n] == '.' || src[n] == '_') {
+		n++
+	}
+
+	if n < len(src) && (src[n] == 'e' || src[n] == 'E') {
+		exp := n + 1
+		if exp < len(src) && (src[exp] == '+' || src[exp] == '-') {
+			exp++
+		}
+		if exp < len(src) && isDigit(src[exp]) {
+			n = exp
+			for n < len(src) && isDigit(src[n]) {
+				n++
+			}
+		}
+	}
+
+	return n
+}
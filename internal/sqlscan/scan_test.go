@@ -0,0 +1,63 @@
+package sqlscan
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenize(t *testing.T) {
+	t.Parallel()
+
+	tokens, err := Tokenize(`select "a""b", $1, 'it''s $2', E'\' $3', $$ $4 $$, $fn$ $5 $fn$ -- $6
+/* /* $7 */ */ foo$1 1.5e3`)
+	assert.NoError(t, err)
+
+	var kinds []Kind
+	var texts []string
+	for _, tok := range tokens {
+		if tok.Kind == Whitespace {
+			continue
+		}
+		kinds = append(kinds, tok.Kind)
+		texts = append(texts, tok.Text)
+	}
+
+	assert.Equal(t, []string{
+		"select", `"a""b"`, ",", "$1", ",", `'it''s $2'`, ",", `E'\' $3'`, ",",
+		"$$ $4 $$", ",", "$fn$ $5 $fn$", "-- $6", "/* /* $7 */ */", "foo$1", "1.5e3",
+	}, texts)
+	assert.Equal(t, []Kind{
+		Ident, QuotedIdent, Punct, Param, Punct, String, Punct, String, Punct,
+		String, Punct, String, Comment, Comment, Ident, Number,
+	}, kinds)
+}
+
+func TestTokenizeRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	src := "create table \"Users\" (\n  id int primary key -- the id\n);"
+
+	tokens, err := Tokenize(src)
+	assert.NoError(t, err)
+
+	builder := strings.Builder{}
+	for _, tok := range tokens {
+		builder.WriteString(tok.Text)
+	}
+	assert.Equal(t, src, builder.String())
+
+	assert.Equal(t, Pos{Offset: 25, Line: 2, Col: 3}, tokens[8].Pos)
+	assert.Equal(t, "Users", tokens[4].Value())
+	assert.True(t, tokens[0].Is("CREATE"))
+}
+
+func TestTokenizeUnterminated(t *testing.T) {
+	t.Parallel()
+
+	for _, src := range []string{"'abc", `"abc`, "/* abc", "$a$ abc", "E'abc\\'"} {
+		_, err := Tokenize(src)
+		assert.Error(t, err, src)
+	}
+}
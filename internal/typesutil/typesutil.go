@@ -0,0 +1,117 @@
+// Package typesutil finds jagger tables in type checked go packages
+package typesutil
+
+import (
+	"go/types"
+	"reflect"
+
+	"github.com/tronikelis/jagger/tags"
+	"golang.org/x/tools/go/packages"
+)
+
+const JaggerPath = "github.com/tronikelis/jagger"
+
+// loads and type checks the packages from source,
+// export data of a newer toolchain might not be readable
+func Load(patterns ...string) ([]*packages.Package, error) {
+	cfg := &packages.Config{Mode: packages.NeedName | packages.NeedFiles | packages.NeedImports |
+		packages.NeedDeps | packages.NeedTypes | packages.NeedSyntax | packages.NeedTypesInfo}
+
+	return packages.Load(cfg, patterns...)
+}
+
+// reports whether named implements jagger.Table
+func IsTable(named *types.Named) bool {
+	for _, imp := range append(named.Obj().Pkg().Imports(), named.Obj().Pkg()) {
+		if imp.Path() != JaggerPath {
+			continue
+		}
+
+		obj, _, _ := types.LookupFieldOrMethod(named, false, imp, "jaggerTable")
+		_, ok := obj.(*types.Func)
+		return ok
+	}
+
+	return false
+}
+
+// reports whether typ is jagger.BaseTable
+func IsBaseTable(typ types.Type) bool {
+	named, ok := typ.(*types.Named)
+	return ok && named.Obj().Pkg() != nil && named.Obj().Pkg().Path() == JaggerPath && named.Obj().Name() == "BaseTable"
+}
+
+// reports whether the columns of a field are selected from its struct,
+// with embed, group or as an anonymous struct without a jagger tag like encoding/json does
+func IsEmbed(anonymous bool, typ types.Type, tag tags.JaggerTag) bool {
+	if tag.Embed || tag.Group {
+		return true
+	}
+	if !anonymous || !reflect.ValueOf(tag).IsZero() || IsBaseTable(typ) {
+		return false
+	}
+
+	if ptr, ok := typ.(*types.Pointer); ok {
+		typ = ptr.Elem()
+	}
+
+	_, ok := typ.Underlying().(*types.Struct)
+	return ok
+}
+
+// the named struct types in pkg which implement jagger.Table
+func Tables(pkg *types.Package) []*types.Named {
+	var tables []*types.Named
+
+	scope := pkg.Scope()
+	for _, name := range scope.Names() {
+		obj, ok := scope.Lookup(name).(*types.TypeName)
+		if !ok || obj.IsAlias() {
+			continue
+		}
+
+		named, ok := obj.Type().(*types.Named)
+		if !ok || named.TypeParams().Len() != 0 {
+			continue
+		}
+		if _, ok := named.Underlying().(*types.Struct); !ok {
+			continue
+		}
+
+		if IsTable(named) {
+			tables = append(tables, named)
+		}
+	}
+
+	return tables
+}
+
+// returns the named struct behind typ, pointers, slices and maps are dereferenced
+func Struct(typ types.Type) (*types.Named, *types.Struct) {
+	for {
+		switch t := typ.(type) {
+		case *types.Pointer:
+			typ = t.Elem()
+			continue
+		case *types.Slice:
+			typ = t.Elem()
+			continue
+		case *types.Map:
+			typ = t.Elem()
+			continue
+		}
+		break
+	}
+
+	named, ok := typ.(*types.Named)
+	if !ok {
+		return nil, nil
+	}
+
+	st, ok := named.Underlying().(*types.Struct)
+	if !ok {
+		return nil, nil
+	}
+
+	return named, st
+}
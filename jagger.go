@@ -1,17 +1,29 @@
 package jagger
 
 import (
+	"encoding/json"
 	"fmt"
 	"maps"
+	"math/big"
 	"reflect"
+	"slices"
 	"strings"
+	"sync"
 
+	"github.com/tronikelis/jagger/internal/dominance"
 	"github.com/tronikelis/jagger/relation"
 	"github.com/tronikelis/jagger/tags"
 )
 
 type BaseTable struct{}
 
+func (BaseTable) jaggerTable() {}
+
+// Table is implemented by every struct that has BaseTable embedded
+type Table interface {
+	jaggerTable()
+}
+
 type (
 	JoinType = relation.JoinType
 	SubQuery = relation.SubQuery
@@ -23,12 +35,34 @@ type joinParams struct {
 }
 
 type joinTree struct {
-	field    string
-	params   joinParams
+	field  string
+	params joinParams
+	// only joined as a parent of other join paths
+	implicit bool
+	where    []relation.Condition
 	children []*joinTree
 }
 
-func upsertJoinTree(current *joinTree, params joinParams, fields []string) {
+// returns the node at path, nil if it is not joined
+func (j *joinTree) find(path string) *joinTree {
+	if path == "" {
+		return j
+	}
+
+	current := j
+	for _, field := range strings.Split(path, ".") {
+		i := slices.IndexFunc(current.children, func(child *joinTree) bool { return child.field == field })
+		if i == -1 {
+			return nil
+		}
+
+		current = current.children[i]
+	}
+
+	return current
+}
+
+func upsertJoinTree(current *joinTree, params joinParams, fields []string) error {
 	for i, field := range fields {
 		found := false
 
@@ -40,28 +74,39 @@ func upsertJoinTree(current *joinTree, params joinParams, fields []string) {
 			}
 		}
 
+		// intermediate relations which are not joined explicitly inherit the join type,
+		// an explicit join on them sets their params regardless of the order
 		if !found {
-			j := &joinTree{field: field}
+			j := &joinTree{field: field, implicit: true}
 			j.params.joinType = params.joinType
 			current.children = append(current.children, j)
 			current = j
+		} else if current.implicit && i < len(fields)-1 && current.params.joinType != params.joinType {
+			return fmt.Errorf("%w, %s is joined with %s and %s by paths through it, join it explicitly",
+				ErrJoinType, strings.Join(fields[:i+1], "."), current.params.joinType, params.joinType)
 		}
 
 		if i == len(fields)-1 {
 			current.params = params
+			current.implicit = false
 		}
 	}
+
+	return nil
 }
 
-func newJoinTree(rootParams joinParams, joins map[string]joinParams) *joinTree {
+func newJoinTree(rootParams joinParams, joins map[string]joinParams) (*joinTree, error) {
 	joinTree := &joinTree{params: rootParams}
 
-	for k, v := range joins {
+	// sorted, so the generated sql and arguments are stable
+	for _, k := range slices.Sorted(maps.Keys(joins)) {
 		fields := strings.Split(k, ".")
-		upsertJoinTree(joinTree, v, fields)
+		if err := upsertJoinTree(joinTree, joins[k], fields); err != nil {
+			return nil, err
+		}
 	}
 
-	return joinTree
+	return joinTree, nil
 }
 
 type QueryBuilder struct {
@@ -70,43 +115,182 @@ type QueryBuilder struct {
 	params joinParams
 
 	joins map[string]joinParams
+
+	// every method works on a copy when set,
+	// so the builder can be shared between goroutines
+	immutable bool
+
+	joinAll joinAll
+
+	// conditions by join path, empty path for the root
+	where map[string][]relation.Condition
+
+	// maps or structs of named parameters
+	named []any
+
+	dedupArgs bool
+
+	// keyset pagination of the root, nil if not paginated
+	page *page
+
+	envelope bool
+	compact  bool
+}
+
+// joins every relation up to depth, zero depth disables it
+type joinAll struct {
+	depth    int
+	joinType JoinType
+}
+
+// the last segment of a join path which joins every relation of the struct
+const wildcard = "*"
+
+type tableField struct {
+	// the go field name
+	name string
+	// index path from the table struct, longer for embedded fields
+	index []int
+	typ   reflect.Type
+	tag   tags.JaggerTag
+	json  string
+	// the named embeds and groups the field is nested in, outermost first
+	parents []tableGroup
+}
+
+type tableGroup struct {
+	json string
+	// null when all of its columns are null
+	null bool
 }
 
 type table struct {
+	// the struct type, pointers and slices dereferenced
+	typ          reflect.Type
 	name         string
-	fieldsByName map[string]reflect.StructField
-	fields       []reflect.StructField
+	fieldsByName map[string]tableField
+	fields       []tableField
+}
+
+// embed fields and anonymous structs without a jagger tag are flattened,
+// like encoding/json promotes the fields of anonymous structs
+func isEmbed(field FieldMeta) bool {
+	if field.Jagger.Embed {
+		return true
+	}
+	if !field.Anonymous || !reflect.ValueOf(field.Jagger).IsZero() || field.Type == reflect.TypeOf(BaseTable{}) {
+		return false
+	}
+
+	typ := field.Type
+	if typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+
+	return typ.Kind() == reflect.Struct
+}
+
+// reports whether a relation of typ is joined on a fk column of the parent
+func isOne(typ reflect.Type) bool {
+	if typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+
+	return typ.Kind() == reflect.Struct
+}
+
+// drops fields hidden by the encoding/json rules
+func dominantFields(fields []tableField) []tableField {
+	return dominance.Fields(fields, func(f tableField) dominance.Field {
+		keys := make([]string, 0, len(f.parents)+1)
+		for _, p := range f.parents {
+			keys = append(keys, p.json)
+		}
+
+		name := f.json
+		if name == "" {
+			name = f.name
+		}
+
+		return dominance.Field{Key: strings.Join(append(keys, name), "."), Depth: len(f.index), Tagged: f.json != ""}
+	})
 }
 
 func newTable(typ reflect.Type) (table, error) {
+	// the structs being embedded, a struct can embed a pointer to itself
+	chain := map[reflect.Type]bool{}
+
 	var inner func(typ reflect.Type) (table, error)
 	inner = func(typ reflect.Type) (table, error) {
-		if typ.Kind() == reflect.Pointer || typ.Kind() == reflect.Slice {
+		if typ.Kind() == reflect.Pointer || typ.Kind() == reflect.Slice || typ.Kind() == reflect.Map {
 			typ = typ.Elem()
 		}
 		if typ.Kind() != reflect.Struct {
-			return table{}, fmt.Errorf("Passed type not struct, got %v", typ)
+			return table{}, fmt.Errorf("%w, got %v", ErrNotStruct, typ)
 		}
 
-		t := table{fieldsByName: map[string]reflect.StructField{}}
+		chain[typ] = true
+		defer delete(chain, typ)
+
+		t := table{typ: typ, fieldsByName: map[string]tableField{}}
+
+		fields, err := structFields(typ)
+		if err != nil {
+			return table{}, err
+		}
 
-		for i := range typ.NumField() {
-			field := typ.Field(i)
-			tag := tags.NewJaggerTag(field.Tag)
+		for _, field := range fields {
+			tag := field.Jagger
 
 			if field.Type == reflect.TypeOf(BaseTable{}) {
 				t.name = tag.Name
 				continue
 			}
 
-			if tag.Embed {
+			if isEmbed(field) || tag.Group {
+				// like encoding/json, a struct already on the chain is not embedded again
+				embeddedType := field.Type
+				if embeddedType.Kind() == reflect.Pointer {
+					embeddedType = embeddedType.Elem()
+				}
+				if chain[embeddedType] {
+					continue
+				}
+
 				embedded, err := inner(field.Type)
 				if err != nil {
 					return table{}, err
 				}
 
-				maps.Copy(t.fieldsByName, embedded.fieldsByName)
-				t.fields = append(t.fields, embedded.fields...)
+				// like encoding/json, named embeds are nested under their json key
+				jsonName := tags.ParseSliceTag(field.Tag.Get("json"))[0]
+				nested := tag.Group || !field.Anonymous || jsonName != ""
+				if jsonName == "" {
+					jsonName = field.Name
+				}
+
+				for _, ef := range embedded.fields {
+					ef.index = append([]int{field.Index}, ef.index...)
+
+					if ef.tag.FK == "" {
+						ef.tag.Name = tag.Prefix + ef.tag.Name
+					} else if isOne(ef.typ) {
+						// the fk of a one relation is a column of this table
+						ef.tag.FK = tag.Prefix + ef.tag.FK
+					}
+
+					if nested {
+						if ef.tag.FK != "" {
+							return table{}, fmt.Errorf("%w %s in %s, relations can not be nested under %s",
+								ErrInvalidRelation, ef.name, typ, field.Name)
+						}
+
+						ef.parents = append([]tableGroup{{json: jsonName, null: tag.Group}}, ef.parents...)
+					}
+
+					t.fieldsByName[ef.name] = ef
+					t.fields = append(t.fields, ef)
+				}
 				if embedded.name != "" {
 					t.name = embedded.name
 				}
@@ -117,8 +301,16 @@ func newTable(typ reflect.Type) (table, error) {
 				continue
 			}
 
-			t.fieldsByName[field.Name] = field
-			t.fields = append(t.fields, field)
+			tf := tableField{
+				name:  field.Name,
+				index: []int{field.Index},
+				typ:   field.Type,
+				tag:   tag,
+				json:  tags.ParseSliceTag(field.Tag.Get("json"))[0],
+			}
+
+			t.fieldsByName[field.Name] = tf
+			t.fields = append(t.fields, tf)
 		}
 
 		return t, nil
@@ -129,99 +321,350 @@ func newTable(typ reflect.Type) (table, error) {
 		return table{}, err
 	}
 
+	t.fields = dominantFields(t.fields)
+	t.fieldsByName = map[string]tableField{}
+	for _, f := range t.fields {
+		// a shallower field hides deeper ones with the same go name
+		if existing, ok := t.fieldsByName[f.name]; ok && len(existing.index) <= len(f.index) {
+			continue
+		}
+		t.fieldsByName[f.name] = f
+	}
+
 	if t.name == "" {
-		return table{}, fmt.Errorf("Passed type does not have BaseTable embedded")
+		return table{}, fmt.Errorf("%w, got %v", ErrNoBaseTable, typ)
 	}
 
 	return t, nil
 }
 
-func toRelation(table table, joinTree *joinTree) (relation.Relation, error) {
+// adds the relations of wildcard paths and JoinAll to the tree,
+// joins which were added explicitly keep their params
+func expandJoinTree(table table, tree *joinTree, all joinAll, path string, ancestors []reflect.Type) error {
+	ancestors = append(ancestors, table.typ)
+
+	has := func(field string) bool {
+		return slices.ContainsFunc(tree.children, func(child *joinTree) bool { return child.field == field })
+	}
+
+	if i := slices.IndexFunc(tree.children, func(child *joinTree) bool { return child.field == wildcard }); i != -1 {
+		w := tree.children[i]
+		if len(w.children) != 0 {
+			return fmt.Errorf("%s has to be the last segment of the join path, at %s", wildcard, JoinPath(path, wildcard))
+		}
+
+		tree.children = slices.Delete(tree.children, i, i+1)
+		for _, f := range table.fields {
+			if f.tag.FK != "" && !has(f.name) {
+				tree.children = append(tree.children, &joinTree{field: f.name, params: w.params})
+			}
+		}
+	}
+
+	if len(ancestors) <= all.depth {
+		for _, f := range table.fields {
+			if f.tag.FK == "" || has(f.name) {
+				continue
+			}
+
+			t, err := newTable(f.typ)
+			if err != nil {
+				return err
+			}
+
+			// User.Songs.User would never end
+			if slices.Contains(ancestors, t.typ) {
+				continue
+			}
+
+			tree.children = append(tree.children, &joinTree{field: f.name, params: joinParams{joinType: all.joinType}})
+		}
+	}
+
+	for _, child := range tree.children {
+		// invalid fields are reported by toRelation
+		f, ok := table.fieldsByName[child.field]
+		if !ok || f.tag.FK == "" {
+			continue
+		}
+
+		t, err := newTable(f.typ)
+		if err != nil {
+			return err
+		}
+
+		if err := expandJoinTree(t, child, all, JoinPath(path, child.field), ancestors); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Expr is implemented by field types which select their column themselves,
+// for example ST_AsGeoJSON(alias.column)::json, alias and column are quoted
+type Expr interface {
+	JaggerExpr(alias, column string) string
+}
+
+var exprType = reflect.TypeFor[Expr]()
+
+// returns Expr of typ if it or its pointer implements it,
+// interfaces have no value to call it on
+func exprOf(typ reflect.Type) (Expr, bool) {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+
+	if typ.Kind() == reflect.Interface {
+		return nil, false
+	}
+
+	if typ.Implements(exprType) {
+		return reflect.New(typ).Elem().Interface().(Expr), true
+	}
+	if reflect.PointerTo(typ).Implements(exprType) {
+		return reflect.New(typ).Interface().(Expr), true
+	}
+
+	return nil, false
+}
+
+var (
+	jsonUnmarshaler = reflect.TypeFor[json.Unmarshaler]()
+	bigFloat        = reflect.TypeFor[big.Float]()
+	bigRat          = reflect.TypeFor[big.Rat]()
+)
+
+var textTypes sync.Map
+
+// makes columns of type T be cast to text by default,
+// for decimal types which can only be unmarshaled from a json string
+func RegisterText[T any]() {
+	textTypes.Store(reflect.TypeFor[T](), true)
+}
+
+// how a column is selected if the tag does not say,
+// so it can be unmarshaled into typ without losing anything
+func defaultEncoding(typ reflect.Type) (cast string, encode string) {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+
+	ptr := reflect.PointerTo(typ)
+	if ptr.Implements(jsonUnmarshaler) {
+		return "", ""
+	}
+
+	// encoding/json expects base64, postgres returns bytea as \x hex
+	if typ.Kind() == reflect.Slice && typ.Elem().Kind() == reflect.Uint8 {
+		return "", "base64"
+	}
+
+	// big.Float, big.Rat and registered types can not be unmarshaled from a json number,
+	// other text types like netip.Addr keep the json postgres returns for them
+	if _, ok := textTypes.Load(typ); ok || typ == bigFloat || typ == bigRat {
+		return "text", ""
+	}
+
+	return "", ""
+}
+
+// appends field to the group of fields at parents
+func nestField(fields []relation.Field, parents []tableGroup, field relation.Field) []relation.Field {
+	if len(parents) == 0 {
+		return append(fields, field)
+	}
+
+	i := slices.IndexFunc(fields, func(f relation.Field) bool { return f.Json == parents[0].json && f.Fields != nil })
+	if i == -1 {
+		fields = append(fields, relation.Field{Json: parents[0].json, Fields: []relation.Field{}, Null: parents[0].null})
+		i = len(fields) - 1
+	}
+
+	fields[i].Fields = nestField(fields[i].Fields, parents[1:], field)
+
+	return fields
+}
+
+// path is the join path of table, empty for the root
+func toRelation(table table, joinTree *joinTree, path string) (relation.Relation, error) {
 	currentRel := relation.Relation{
 		SubQuery: joinTree.params.subQuery,
 		JoinType: joinTree.params.joinType,
 		Table:    table.name,
+		Path:     path,
+		Where:    joinTree.where,
 	}
 
 	for _, f := range table.fields {
-		tag := tags.NewJaggerTag(f.Tag)
-		jsonTag := tags.ParseSliceTag(f.Tag.Get("json"))
-
-		if tag.PK {
-			currentRel.PK = tag.Name
+		if f.tag.PK {
+			currentRel.PK = f.tag.Name
 		}
 
 		// this is a join field, will add these in the next loop
-		if tag.FK != "" {
+		if f.tag.FK != "" {
 			continue
 		}
 
-		currentRel.Fields = append(currentRel.Fields, relation.Field{Json: jsonTag[0], Column: tag.Name})
+		field := relation.Field{Json: f.json, Column: f.tag.Name, Index: f.index, Cast: f.tag.Cast, Encode: f.tag.Encode}
+		if expr, ok := exprOf(f.typ); ok {
+			field.Expr = expr.JaggerExpr
+		} else if field.Cast == "" && field.Encode == "" {
+			field.Cast, field.Encode = defaultEncoding(f.typ)
+		}
+
+		currentRel.Fields = nestField(currentRel.Fields, f.parents, field)
 	}
 
 	for _, child := range joinTree.children {
+		childPath := JoinPath(path, child.field)
+
 		f, ok := table.fieldsByName[child.field]
-		if !ok {
-			return relation.Relation{}, fmt.Errorf("Field %s not found", child.field)
+		if !ok || f.tag.FK == "" {
+			return relation.Relation{}, newFieldNotFoundError(childPath, child.field, table)
 		}
 
-		t, err := newTable(f.Type)
+		t, err := newTable(f.typ)
 		if err != nil {
 			return relation.Relation{}, err
 		}
 
-		rel, err := toRelation(t, child)
+		rel, err := toRelation(t, child, childPath)
 		if err != nil {
 			return relation.Relation{}, err
 		}
 		rel.ParentTable = currentRel.Table
 
-		tag := tags.NewJaggerTag(f.Tag)
-		jsonTag := tags.ParseSliceTag(f.Tag.Get("json"))
+		rel.FK = f.tag.FK
+		rel.JsonName = f.json
+		rel.Index = f.index
 
-		rel.FK = tag.FK
-		rel.JsonName = jsonTag[0]
-
-		fType := f.Type
+		fType := f.typ
 		if fType.Kind() == reflect.Pointer {
 			fType = fType.Elem()
 		}
 
+		if (fType.Kind() == reflect.Map) != (f.tag.Key != "") {
+			return relation.Relation{}, fmt.Errorf("%w %s type at %s, maps need key: and only maps can have it", ErrInvalidRelation, fType.String(), childPath)
+		}
+		rel.Key = f.tag.Key
+
 		switch fType.Kind() {
-		case reflect.Slice:
+		case reflect.Slice, reflect.Map:
 			currentRel.Many = append(currentRel.Many, rel)
 		case reflect.Struct:
 			currentRel.One = append(currentRel.One, rel)
 		default:
-			return relation.Relation{}, fmt.Errorf("Cant join %s type", fType.String())
+			return relation.Relation{}, fmt.Errorf("%w %s type at %s", ErrInvalidRelation, fType.String(), childPath)
 		}
 	}
 
 	return currentRel, nil
 }
 
-func (qb *QueryBuilder) ToSql() (string, []any, error) {
+// builds the relation tree of the selected struct
+func (qb *QueryBuilder) relation() (relation.Relation, error) {
 	if qb.target == nil {
-		return "", nil, fmt.Errorf("ToSql called without target")
+		return relation.Relation{}, ErrNoTarget
 	}
 
 	table, err := newTable(reflect.TypeOf(qb.target))
+	if err != nil {
+		return relation.Relation{}, err
+	}
+
+	tree, err := newJoinTree(qb.params, qb.joins)
+	if err != nil {
+		return relation.Relation{}, err
+	}
+	if err := expandJoinTree(table, tree, qb.joinAll, "", nil); err != nil {
+		return relation.Relation{}, err
+	}
+
+	for _, path := range slices.Sorted(maps.Keys(qb.where)) {
+		node := tree.find(path)
+		if node == nil {
+			return relation.Relation{}, fmt.Errorf("%w, where on %s", ErrNotJoined, path)
+		}
+
+		node.where = qb.where[path]
+	}
+
+	rel, err := toRelation(table, tree, "")
+	if err != nil {
+		return relation.Relation{}, err
+	}
+
+	if qb.page != nil {
+		if qb.params.subQuery != nil {
+			return relation.Relation{}, fmt.Errorf("%w, can not paginate a custom root sub query", ErrInvalidPage)
+		}
+
+		rel.Page, err = qb.page.toRelation(table)
+		if err != nil {
+			return relation.Relation{}, err
+		}
+	}
+
+	rel.Envelope = qb.envelope
+
+	// pages and totals are counted in the root sub query, before the relations are joined
+	if qb.page != nil || qb.envelope {
+		for _, joined := range rootJoins(rel) {
+			if joined.JoinType != relation.LEFT_JOIN {
+				return relation.Relation{}, fmt.Errorf("%w, %s has to be left joined to paginate or count the root rows", ErrInvalidPage, joined.Path)
+			}
+		}
+	}
+
+	if qb.compact {
+		setCompact(&rel)
+	}
+
+	return rel, nil
+}
+
+// the relations joined onto the rows of rel, relations of one relations are joined there too
+func rootJoins(rel relation.Relation) []relation.Relation {
+	joined := slices.Clone(rel.Many)
+	for _, o := range rel.One {
+		joined = append(joined, o)
+		joined = append(joined, rootJoins(o)...)
+	}
+
+	return joined
+}
+
+func setCompact(rel *relation.Relation) {
+	rel.Compact = true
+
+	for i := range rel.One {
+		setCompact(&rel.One[i])
+	}
+	for i := range rel.Many {
+		setCompact(&rel.Many[i])
+	}
+}
+
+func (qb *QueryBuilder) ToSql() (string, []any, error) {
+	rel, err := qb.relation()
 	if err != nil {
 		return "", nil, err
 	}
 
-	rel, err := toRelation(table, newJoinTree(qb.params, qb.joins))
+	named, err := namedParams(qb.named)
 	if err != nil {
 		return "", nil, err
 	}
 
-	var args []any
-	rendered, err := rel.Render(nil, &args)
+	args := relation.Args{Named: named, Dedup: qb.dedupArgs}
+	rendered, err := rel.RenderArgs(nil, &args)
 	if err != nil {
 		return "", nil, err
 	}
 
-	return rendered, args, nil
+	return rendered, args.Values, nil
 }
 
 // calls .ToSql and panics if error
@@ -235,10 +678,31 @@ func (qb *QueryBuilder) MustSql() (string, []any) {
 }
 
 func NewQueryBuilder() *QueryBuilder {
-	return &QueryBuilder{joins: map[string]joinParams{}}
+	return &QueryBuilder{joins: map[string]joinParams{}, where: map[string][]relation.Condition{}}
+}
+
+// returns a builder on which every method returns a new value
+// instead of mutating the receiver
+func (qb *QueryBuilder) Immutable() *QueryBuilder {
+	copied := qb.Clone()
+	copied.immutable = true
+
+	return copied
+}
+
+// returns the builder to apply changes to,
+// a fresh copy for immutable builders or the receiver itself
+func (qb *QueryBuilder) mutable() *QueryBuilder {
+	if qb.immutable {
+		return qb.Clone()
+	}
+
+	return qb
 }
 
 func (qb *QueryBuilder) Select(table any, subQuery SubQuery) *QueryBuilder {
+	qb = qb.mutable()
+
 	qb.target = table
 	qb.params = joinParams{
 		subQuery: subQuery,
@@ -248,6 +712,8 @@ func (qb *QueryBuilder) Select(table any, subQuery SubQuery) *QueryBuilder {
 }
 
 func (qb *QueryBuilder) Join(joinType JoinType, path string, subQuery SubQuery) *QueryBuilder {
+	qb = qb.mutable()
+
 	qb.joins[path] = joinParams{
 		joinType: joinType,
 		subQuery: subQuery,
@@ -256,6 +722,85 @@ func (qb *QueryBuilder) Join(joinType JoinType, path string, subQuery SubQuery)
 	return qb
 }
 
+// joins every relation reachable from the selected struct up to depth,
+// relations back to a struct already on the path are skipped,
+// explicit joins keep their own join type and sub query
+func (qb *QueryBuilder) JoinAll(depth int, joinType JoinType) *QueryBuilder {
+	qb = qb.mutable()
+
+	qb.joinAll = joinAll{depth: depth, joinType: joinType}
+
+	return qb
+}
+
+// filters the relation at path, the root if empty, by an sql condition,
+// placeholders start from $1 like in a sub query, multiple calls are ANDed,
+// with a custom sub query its result is filtered
+func (qb *QueryBuilder) Where(path string, cond string, args ...any) *QueryBuilder {
+	qb = qb.mutable()
+
+	qb.where[path] = append(qb.where[path], relation.Condition{Sql: cond, Args: args})
+
+	return qb
+}
+
+// sets named parameters, a map[string]any or a struct,
+// struct fields are named by their jagger tag name or the field name,
+// sub queries and conditions reference them as @name or :name,
+// every name is bound once even if used in multiple relations
+func (qb *QueryBuilder) Named(params any) *QueryBuilder {
+	qb = qb.mutable()
+
+	qb.named = append(qb.named, params)
+
+	return qb
+}
+
+// identical comparable arguments of all sub queries share one placeholder,
+// postgres infers one type per placeholder, so the same value
+// can not be compared to columns of different types
+func (qb *QueryBuilder) DedupArgs() *QueryBuilder {
+	qb = qb.mutable()
+
+	qb.dedupArgs = true
+
+	return qb
+}
+
+// pages the root rows by orderColumns, mapped columns of the root struct,
+// a - prefix orders descending, directions can be mixed,
+// after is the cursor returned with the previous page, empty for the first one,
+// the query returns the cursor of this page in a second column, jagger_cursor,
+// relations joined onto the root rows have to be left joined
+func (qb *QueryBuilder) Paginate(orderColumns []string, after Cursor, pageSize int) *QueryBuilder {
+	qb = qb.mutable()
+
+	qb.page = &page{columns: slices.Clone(orderColumns), after: after, size: pageSize}
+
+	return qb
+}
+
+// wraps the rows in an object, {"data": [...], "total": 0, "has_more": false, "cursor": ""},
+// total counts the rows before paginating, cursor is only set with Paginate,
+// relations joined onto the root rows have to be left joined
+func (qb *QueryBuilder) Envelope() *QueryBuilder {
+	qb = qb.mutable()
+
+	qb.envelope = true
+
+	return qb
+}
+
+// rows are returned as arrays of values instead of objects,
+// which leaves out the repeated keys, decode them with Unmarshal
+func (qb *QueryBuilder) Compact() *QueryBuilder {
+	qb = qb.mutable()
+
+	qb.compact = true
+
+	return qb
+}
+
 func (qb *QueryBuilder) LeftJoin(path string, subQuery SubQuery) *QueryBuilder {
 	return qb.Join(relation.LEFT_JOIN, path, subQuery)
 }
@@ -272,14 +817,26 @@ func (qb *QueryBuilder) FullOuterJoin(path string, subQuery SubQuery) *QueryBuil
 	return qb.Join(relation.FULL_OUTER_JOIN, path, subQuery)
 }
 
+// copies everything the builder holds, including the root subquery
 func (qb *QueryBuilder) Clone() *QueryBuilder {
 	copied := NewQueryBuilder()
 
-	// only a shallow copy
+	// the target and subqueries are copied by value,
 	// the caller could still change for example
-	// the arguments, but this is fine
+	// the arguments captured by them, but this is fine
 	copied.target = qb.target
+	copied.params = qb.params
+	copied.immutable = qb.immutable
+	copied.joinAll = qb.joinAll
+	copied.named = slices.Clone(qb.named)
+	copied.dedupArgs = qb.dedupArgs
+	copied.page = qb.page
+	copied.envelope = qb.envelope
+	copied.compact = qb.compact
 	maps.Copy(copied.joins, qb.joins)
+	for path, where := range qb.where {
+		copied.where[path] = slices.Clone(where)
+	}
 
 	return copied
 }
@@ -1,16 +1,26 @@
 package jagger_test
 
 import (
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"math/big"
+	"net/netip"
 	"os"
 	"os/exec"
+	"reflect"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/tronikelis/jagger"
+	"github.com/tronikelis/jagger/relation"
+	"github.com/tronikelis/jagger/schema"
+	"github.com/tronikelis/jagger/tags"
 )
 
 func snapshotQbAsync(t *testing.T, wg *sync.WaitGroup, qb *jagger.QueryBuilder, file string) {
@@ -48,7 +58,16 @@ func snapshotQb(t *testing.T, qb *jagger.QueryBuilder, file string) {
 		panic(err)
 	}
 
-	assert.Equal(t, string(oldSqlBytes), newSql)
+	// snapshots can be committed unformatted, WRITE_SQL_SNAPSHOTS formats them
+	oldSql := string(oldSqlBytes)
+	if oldSql != newSql {
+		oldSql, err = cmd(oldSql, "npx", "sql-formatter", "-l", "postgresql")
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	assert.Equal(t, oldSql, newSql)
 }
 
 func cmd(stdin string, name string, args ...string) (string, error) {
@@ -277,6 +296,39 @@ func TestClone(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestCloneCopiesRootSubQuery(t *testing.T) {
+	t.Parallel()
+
+	q := qb().Select(User{}, func(cond string) (string, []any, error) { return "select * from users", []any{1}, nil })
+
+	_, args, err := q.Clone().ToSql()
+	assert.NoError(t, err)
+	assert.Equal(t, []any{1}, args)
+}
+
+func TestImmutable(t *testing.T) {
+	t.Parallel()
+
+	base := qb().Immutable().Select(User{}, nil)
+
+	wg := sync.WaitGroup{}
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			sql, _, err := base.LeftJoin("Songs", nil).ToSql()
+			assert.NoError(t, err)
+			assert.Contains(t, sql, "songs_json")
+		}()
+	}
+	wg.Wait()
+
+	sql, _, err := base.ToSql()
+	assert.NoError(t, err)
+	assert.NotContains(t, sql, "songs_json")
+}
+
 func TestIncrementsArguments(t *testing.T) {
 	t.Parallel()
 
@@ -350,3 +402,905 @@ func TestEmptyPkSkipsCaseWhen(t *testing.T) {
 	snapshotQbAsync(t, &wg, qb().
 		Select(EmptyPk{}, nil), file+"1.sql")
 }
+
+func TestTyped(t *testing.T) {
+	t.Parallel()
+
+	typedSql, _, err := jagger.New[User]().LeftJoin("Songs", nil).ToSql()
+	assert.NoError(t, err)
+
+	sql, _, err := qb().Select(User{}, nil).LeftJoin("Songs", nil).ToSql()
+	assert.NoError(t, err)
+
+	assert.Equal(t, sql, typedSql)
+}
+
+func TestTypedUnmarshal(t *testing.T) {
+	t.Parallel()
+
+	users, err := jagger.New[User]().Unmarshal([]byte(`[{"id": 1, "songs": [{"id": 2, "user_id": 1}]}]`))
+	assert.NoError(t, err)
+	assert.Equal(t, []User{{ID: 1, Songs: []UserSong{{ID: 2, UserId: 1}}}}, users)
+
+	users, err = jagger.New[User]().Unmarshal([]byte("null"))
+	assert.NoError(t, err)
+	assert.Nil(t, users)
+}
+
+type Registered struct {
+	jagger.BaseTable `jagger:"not_used"`
+
+	ID int `jagger:"id,pk:" json:"id"`
+}
+
+func TestRegisterTable(t *testing.T) {
+	t.Parallel()
+
+	// the table name differs from the tag to tell them apart
+	jagger.RegisterTable[Registered](
+		jagger.FieldMeta{Name: "BaseTable", Index: 0, Anonymous: true, Type: reflect.TypeFor[jagger.BaseTable](), Tag: `jagger:"not_used"`, Jagger: tags.JaggerTag{Name: "registered"}},
+		jagger.FieldMeta{Name: "ID", Index: 1, Type: reflect.TypeFor[int](), Tag: `jagger:"id,pk:" json:"id"`, Jagger: tags.JaggerTag{Name: "id", PK: true}},
+	)
+
+	sql, _, err := qb().Select(Registered{}, nil).ToSql()
+	assert.NoError(t, err)
+	assert.Contains(t, sql, `from "registered"`)
+}
+
+type StaleRegistered struct {
+	jagger.BaseTable `jagger:"stale"`
+
+	ID   int    `jagger:"id,pk:" json:"id"`
+	Name string `jagger:"name" json:"name"`
+}
+
+type StaleTag struct {
+	jagger.BaseTable `jagger:"stale_tag"`
+
+	ID int `jagger:"id,pk:" json:"id"`
+}
+
+func TestRegisterTableStale(t *testing.T) {
+	t.Parallel()
+
+	// generated before Name was added
+	jagger.RegisterTable[StaleRegistered](
+		jagger.FieldMeta{Name: "BaseTable", Index: 0, Anonymous: true, Type: reflect.TypeFor[jagger.BaseTable](), Jagger: tags.JaggerTag{Name: "registered"}},
+		jagger.FieldMeta{Name: "ID", Index: 1, Type: reflect.TypeFor[int](), Tag: `json:"id"`, Jagger: tags.JaggerTag{Name: "id", PK: true}},
+	)
+
+	sql, _, err := qb().Select(StaleRegistered{}, nil).ToSql()
+	assert.NoError(t, err)
+	assert.Contains(t, sql, `from "stale"`)
+	assert.Contains(t, sql, `'name', "stale."."name"`)
+
+	var rows []StaleRegistered
+	err = qb().Select(StaleRegistered{}, nil).Compact().Unmarshal([]byte(`[[1, "a"]]`), &rows)
+	assert.NoError(t, err)
+	assert.Equal(t, []StaleRegistered{{ID: 1, Name: "a"}}, rows)
+
+	// generated before the column was renamed from old_id
+	jagger.RegisterTable[StaleTag](
+		jagger.FieldMeta{Name: "BaseTable", Index: 0, Anonymous: true, Type: reflect.TypeFor[jagger.BaseTable](), Tag: `jagger:"stale_tag"`, Jagger: tags.JaggerTag{Name: "stale_tag"}},
+		jagger.FieldMeta{Name: "ID", Index: 1, Type: reflect.TypeFor[int](), Tag: `jagger:"old_id,pk:" json:"id"`, Jagger: tags.JaggerTag{Name: "old_id", PK: true}},
+	)
+
+	sql, _, err = qb().Select(StaleTag{}, nil).ToSql()
+	assert.NoError(t, err)
+	assert.Contains(t, sql, `'id', "stale_tag."."id"`)
+	assert.NotContains(t, sql, `old_id`)
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	s, err := schema.Parse("schema.sql", `
+create table "user" (id int primary key);
+create table user_song (id int primary key, user_id int references "user" (id));
+create table song_track (id int primary key, song_id int references user_song (id));
+`)
+	assert.NoError(t, err)
+	assert.NoError(t, jagger.Validate(s, User{}))
+
+	s, err = schema.Parse("schema.sql", `
+create table "user" (id int);
+create table user_song (id int primary key, user_id int);
+`)
+	assert.NoError(t, err)
+
+	err = jagger.Validate(s, User{})
+	assert.ErrorContains(t, err, "schema.sql:2:22: User.ID: column id is not the primary key of table user")
+	assert.ErrorContains(t, err, "schema.sql:3:45: User.Songs: missing foreign key user_song(user_id) references user")
+	assert.ErrorContains(t, err, "SongTack: table song_track not found")
+}
+
+type BadTag struct {
+	jagger.BaseTable `jagger:"bad"`
+
+	ID int `jagger:"id,pkk:" json:"id"`
+}
+
+func TestStrictTags(t *testing.T) {
+	t.Parallel()
+
+	_, _, err := qb().Select(BadTag{}, nil).ToSql()
+	assert.EqualError(t, err, `BadTag.ID: invalid jagger tag option "pkk:": unknown key pkk`)
+
+	var tagErr *tags.Error
+	assert.ErrorAs(t, err, &tagErr)
+}
+
+func TestStructuredErrors(t *testing.T) {
+	t.Parallel()
+
+	_, _, err := qb().ToSql()
+	assert.ErrorIs(t, err, jagger.ErrNoTarget)
+
+	_, _, err = qb().Select(1, nil).ToSql()
+	assert.ErrorIs(t, err, jagger.ErrNotStruct)
+
+	_, _, err = qb().Select(SomeFieldBar{}, nil).ToSql()
+	assert.ErrorIs(t, err, jagger.ErrNoBaseTable)
+
+	_, _, err = qb().Select(User{}, nil).LeftJoin("Songs.Foo", nil).ToSql()
+	var fieldErr *jagger.FieldNotFoundError
+	assert.ErrorAs(t, err, &fieldErr)
+	assert.Equal(t, "Songs.Foo", fieldErr.Path)
+	assert.Equal(t, reflect.TypeFor[UserSong](), fieldErr.Type)
+
+	subQueryErr := errors.New("sub query failed")
+	_, _, err = qb().Select(User{}, nil).LeftJoin("Songs.Tracks", func(cond string) (string, []any, error) {
+		return "", nil, subQueryErr
+	}).ToSql()
+	assert.ErrorIs(t, err, subQueryErr)
+	var subErr *jagger.SubQueryError
+	assert.ErrorAs(t, err, &subErr)
+	assert.Equal(t, "Songs.Tracks", subErr.Path)
+
+	_, _, err = qb().Select(BadTag{}, nil).ToSql()
+	var tagErr *jagger.TagError
+	assert.ErrorAs(t, err, &tagErr)
+	assert.Equal(t, "ID", tagErr.Field)
+}
+
+func TestJoinPathSuggestion(t *testing.T) {
+	t.Parallel()
+
+	_, _, err := qb().Select(User{}, nil).LeftJoin("Songs.Trakcs", nil).ToSql()
+	assert.EqualError(t, err, "Field Songs.Trakcs not found in jagger_test.UserSong, valid relations: Tracks, User, did you mean Tracks?")
+
+	var fieldErr *jagger.FieldNotFoundError
+	assert.ErrorAs(t, err, &fieldErr)
+	assert.Equal(t, []string{"Tracks", "User"}, fieldErr.Valid)
+	assert.Equal(t, "Tracks", fieldErr.Suggestion)
+
+	// columns are not relations
+	_, _, err = qb().Select(User{}, nil).LeftJoin("Songs.ID", nil).ToSql()
+	assert.ErrorAs(t, err, &fieldErr)
+	assert.Equal(t, "Songs.ID", fieldErr.Path)
+
+	_, _, err = qb().Select(User{}, nil).LeftJoin("songs", nil).ToSql()
+	assert.EqualError(t, err, "Field songs not found in jagger_test.User, valid relations: Songs, did you mean Songs?")
+
+	_, _, err = qb().Select(EmptyPk{}, nil).LeftJoin("Foo", nil).ToSql()
+	assert.EqualError(t, err, "Field Foo not found in jagger_test.EmptyPk, it has no relations")
+}
+
+func TestIntermediateJoinType(t *testing.T) {
+	t.Parallel()
+
+	sql, _, err := qb().Select(User{}, nil).InnerJoin("Songs.Tracks", nil).ToSql()
+	assert.NoError(t, err)
+	assert.Contains(t, sql, `inner join lateral (select "user.songs"`)
+	assert.Contains(t, sql, `inner join lateral (select "user_song.tracks"`)
+
+	sql, _, err = qb().Select(User{}, nil).InnerJoin("Songs.Tracks", nil).LeftJoin("Songs", nil).ToSql()
+	assert.NoError(t, err)
+	assert.Contains(t, sql, `left join lateral (select "user.songs"`)
+	assert.Contains(t, sql, `inner join lateral (select "user_song.tracks"`)
+
+	// the implicit Songs would depend on which path sorts first
+	_, _, err = qb().Select(User{}, nil).InnerJoin("Songs.Tracks", nil).LeftJoin("Songs.User", nil).ToSql()
+	assert.ErrorIs(t, err, jagger.ErrJoinType)
+
+	_, _, err = qb().Select(User{}, nil).InnerJoin("Songs.Tracks", nil).LeftJoin("Songs.User", nil).LeftJoin("Songs", nil).ToSql()
+	assert.NoError(t, err)
+
+	_, _, err = qb().Select(User{}, nil).LeftJoin("Songs.Tracks", nil).LeftJoin("Songs.User", nil).ToSql()
+	assert.NoError(t, err)
+}
+
+func TestJoinAll(t *testing.T) {
+	t.Parallel()
+
+	sql, _, err := qb().Select(User{}, nil).JoinAll(10, relation.LEFT_JOIN).ToSql()
+	assert.NoError(t, err)
+
+	// Songs.User and Songs.Tracks.Song point back to the path
+	expected, _, err := qb().Select(User{}, nil).LeftJoin("Songs", nil).LeftJoin("Songs.Tracks", nil).ToSql()
+	assert.NoError(t, err)
+	assert.Equal(t, expected, sql)
+
+	sql, _, err = qb().Select(User{}, nil).JoinAll(1, relation.LEFT_JOIN).ToSql()
+	assert.NoError(t, err)
+	assert.Contains(t, sql, `"user.songs"`)
+	assert.NotContains(t, sql, `"user_song.tracks"`)
+
+	sql, _, err = qb().Select(User{}, nil).JoinAll(1, relation.LEFT_JOIN).InnerJoin("Songs", nil).ToSql()
+	assert.NoError(t, err)
+	assert.Contains(t, sql, `inner join lateral (select "user.songs"`)
+
+	sql, _, err = jagger.New[User]().JoinAll(1, relation.INNER_JOIN).ToSql()
+	assert.NoError(t, err)
+	assert.Contains(t, sql, `inner join lateral (select "user.songs"`)
+}
+
+func TestJoinWildcard(t *testing.T) {
+	t.Parallel()
+
+	sql, _, err := qb().Select(User{}, nil).InnerJoin("Songs.*", nil).ToSql()
+	assert.NoError(t, err)
+	assert.Contains(t, sql, `inner join lateral (select "user.songs"`)
+	assert.Contains(t, sql, `inner join lateral (select "user_song.tracks"`)
+	assert.Contains(t, sql, `inner join lateral (select *, row_number() over () as jagger_rn from "user" where "user"."id" = "user.songs"."user_id") "user_song.user"`)
+
+	sql, _, err = qb().Select(User{}, nil).InnerJoin("Songs", nil).InnerJoin("Songs.*", nil).LeftJoin("Songs.User", nil).ToSql()
+	assert.NoError(t, err)
+	assert.Contains(t, sql, `left join lateral (select *, row_number() over () as jagger_rn from "user" where "user"."id" = "user.songs"."user_id") "user_song.user"`)
+
+	_, _, err = qb().Select(User{}, nil).LeftJoin("*.Tracks", nil).ToSql()
+	assert.Error(t, err)
+}
+
+func TestWhere(t *testing.T) {
+	t.Parallel()
+
+	file := TEST_SQL_BASE + "/test_where"
+	wg := sync.WaitGroup{}
+	defer wg.Wait()
+
+	conditions := qb().
+		Select(User{}, nil).
+		Where("", "id > $1", 10).
+		LeftJoin("Songs", nil).
+		Where("Songs", "title ilike $1", "%rock%").
+		Where("Songs", "id <> $1 and id <> $2", 1, 2)
+	_, args, err := conditions.ToSql()
+	assert.NoError(t, err)
+	assert.Equal(t, []any{10, "%rock%", 1, 2}, args)
+	snapshotQbAsync(t, &wg, conditions, file+"1.sql")
+
+	subQuery := qb().
+		Select(User{}, nil).
+		LeftJoin("Songs", func(cond string) (string, []any, error) {
+			return "select *, row_number() over () as jagger_rn from user_song where " + cond + " and id > $1", []any{5}, nil
+		}).
+		Where("Songs", "title = $1", "a")
+	_, args, err = subQuery.ToSql()
+	assert.NoError(t, err)
+	assert.Equal(t, []any{5, "a"}, args)
+	snapshotQbAsync(t, &wg, subQuery, file+"2.sql")
+
+	_, _, err = qb().Select(User{}, nil).Where("Songs", "true").ToSql()
+	assert.ErrorIs(t, err, jagger.ErrNotJoined)
+
+	base := qb().Immutable().Select(User{}, nil).Where("", "id = $1", 1)
+	base.Where("", "id = $1", 2)
+	_, args, err = base.ToSql()
+	assert.NoError(t, err)
+	assert.Equal(t, []any{1}, args)
+}
+
+type fakeSqlizer struct {
+	sql  string
+	args []any
+}
+
+func (f fakeSqlizer) ToSql() (string, []any, error) {
+	return f.sql, f.args, nil
+}
+
+func TestSqlizer(t *testing.T) {
+	t.Parallel()
+
+	sql, args, err := qb().
+		Select(User{}, jagger.FromSqlizer(fakeSqlizer{"select *, row_number() over () as jagger_rn from users where id = $1", []any{1}})).
+		LeftJoin("Songs", jagger.FromSqlizerFunc(func(cond string) jagger.Sqlizer {
+			return jagger.SqlizerFunc(func() (string, []any, error) {
+				return "select *, row_number() over () as jagger_rn from user_song where " + cond + " and id > $1", []any{2}, nil
+			})
+		})).
+		ToSql()
+	assert.NoError(t, err)
+	assert.Contains(t, sql, `from users where id = $1) "user."`)
+	assert.Contains(t, sql, `from user_song where "user_song"."user_id" = "user."."id" and id > $2) "user.songs"`)
+	assert.Equal(t, []any{1, 2}, args)
+
+	_, _, err = qb().
+		Select(User{}, jagger.FromSqlizer(fakeSqlizer{"select * from users where id = ?", []any{1}})).
+		ToSql()
+	assert.ErrorIs(t, err, jagger.ErrPlaceholders)
+
+	var subQueryErr *jagger.SubQueryError
+	assert.ErrorAs(t, err, &subQueryErr)
+}
+
+func TestNamed(t *testing.T) {
+	t.Parallel()
+
+	sql, args, err := qb().
+		Select(User{}, func(cond string) (string, []any, error) {
+			return "select *, row_number() over () as jagger_rn from users where tenant_id = @tenant_id and id = $1", []any{1}, nil
+		}).
+		LeftJoin("Songs", func(cond string) (string, []any, error) {
+			return "select *, row_number() over () as jagger_rn from user_song where " + cond + " and tenant_id = :tenant_id and created::date = :day and '@tenant_id' <> ''", nil, nil
+		}).
+		Where("Songs", "title = @title").
+		Named(map[string]any{"tenant_id": 7, "day": "2024-01-01"}).
+		Named(struct {
+			Title string `jagger:"title"`
+			Other int
+		}{Title: "a"}).
+		ToSql()
+	assert.NoError(t, err)
+	assert.Contains(t, sql, `where tenant_id = $2 and id = $1) "user."`)
+	assert.Contains(t, sql, `and tenant_id = $2 and created::date = $3 and '@tenant_id' <> '') "user.songs" where (title = $4)) "user.songs"`)
+	assert.Equal(t, []any{1, 7, "2024-01-01", "a"}, args)
+
+	_, _, err = qb().Select(User{}, nil).Named(1).ToSql()
+	assert.ErrorIs(t, err, jagger.ErrInvalidNamed)
+}
+
+func TestDedupArgs(t *testing.T) {
+	t.Parallel()
+
+	build := func() *jagger.QueryBuilder {
+		return qb().
+			Select(User{}, nil).
+			Where("", "tenant_id = $1 and id = $2", 7, 1).
+			LeftJoin("Songs", nil).
+			Where("Songs", "tenant_id = $1 and tags = $2 and id <> $3", 7, []string{"a"}, 1).
+			Where("Songs", "tenant_id = @tenant_id").
+			Named(map[string]any{"tenant_id": 7})
+	}
+
+	sql, args, err := build().DedupArgs().ToSql()
+	assert.NoError(t, err)
+	assert.Contains(t, sql, `where (tenant_id = $1 and id = $2)) "user."`)
+	assert.Contains(t, sql, `and (tenant_id = $1 and tags = $3 and id <> $2) and (tenant_id = $1)) "user.songs"`)
+	assert.Equal(t, []any{7, 1, []string{"a"}}, args)
+
+	_, args, err = build().ToSql()
+	assert.NoError(t, err)
+	assert.Equal(t, []any{7, 1, 7, []string{"a"}, 1, 7}, args)
+
+	_, _, err = qb().Select(User{}, nil).Where("", "id = $2", 1).DedupArgs().ToSql()
+	assert.Error(t, err)
+}
+
+type Article struct {
+	jagger.BaseTable `jagger:"articles"`
+
+	ID        int    `jagger:"id, pk:" json:"id"`
+	Name      string `jagger:"name" json:"name"`
+	CreatedAt string `jagger:"created_at" json:"created_at"`
+}
+
+func TestPaginate(t *testing.T) {
+	t.Parallel()
+
+	file := TEST_SQL_BASE + "/test_paginate"
+	wg := sync.WaitGroup{}
+	defer wg.Wait()
+
+	snapshotQbAsync(t, &wg, qb().Select(User{}, nil).Paginate([]string{"id"}, "", 10), file+"1.sql")
+
+	cursor := jagger.Cursor(base64.RawURLEncoding.EncodeToString([]byte(`{"id":5,"name":"a"}`)))
+	desc := qb().
+		Select(Article{}, nil).
+		Where("", "id <> $1", 1).
+		Paginate([]string{"-name", "-id"}, cursor, 10)
+	_, args, err := desc.ToSql()
+	assert.NoError(t, err)
+	assert.Equal(t, []any{1, `{"id":5,"name":"a"}`}, args)
+	snapshotQbAsync(t, &wg, desc, file+"2.sql")
+
+	// rows can not be compared in mixed directions
+	cursor = jagger.Cursor(base64.RawURLEncoding.EncodeToString([]byte(`{"created_at":"2024-01-01","id":5}`)))
+	mixed := qb().Select(Article{}, nil).Paginate([]string{"-created_at", "id"}, cursor, 10)
+	_, args, err = mixed.ToSql()
+	assert.NoError(t, err)
+	assert.Equal(t, []any{`{"created_at":"2024-01-01","id":5}`}, args)
+	snapshotQbAsync(t, &wg, mixed, file+"3.sql")
+
+	_, _, err = qb().Select(User{}, nil).Paginate(nil, "", 10).ToSql()
+	assert.ErrorIs(t, err, jagger.ErrInvalidPage)
+
+	_, _, err = qb().Select(User{}, nil).Paginate([]string{"id"}, "not a cursor", 10).ToSql()
+	assert.ErrorIs(t, err, jagger.ErrInvalidCursor)
+
+	_, _, err = qb().Select(Article{}, nil).Paginate([]string{"name"}, cursor[:len(cursor)-1]+"x", 10).ToSql()
+	assert.ErrorIs(t, err, jagger.ErrInvalidCursor)
+
+	// order columns usually come from a request
+	for _, column := range []string{"name", `id" desc, "name`, "name'", "Songs"} {
+		_, _, err = qb().Select(User{}, nil).Paginate([]string{column}, "", 10).ToSql()
+		assert.ErrorIs(t, err, jagger.ErrInvalidPage, column)
+	}
+
+	_, _, err = qb().
+		Select(User{}, func(cond string) (string, []any, error) { return "", nil, nil }).
+		Paginate([]string{"id"}, "", 10).
+		ToSql()
+	assert.ErrorIs(t, err, jagger.ErrInvalidPage)
+}
+
+func TestEnvelope(t *testing.T) {
+	t.Parallel()
+
+	file := TEST_SQL_BASE + "/test_envelope"
+	wg := sync.WaitGroup{}
+	defer wg.Wait()
+
+	snapshotQbAsync(t, &wg, qb().Select(User{}, nil).Envelope(), file+"1.sql")
+
+	cursor := jagger.Cursor(base64.RawURLEncoding.EncodeToString([]byte(`{"id":5}`)))
+	paged := qb().
+		Select(User{}, nil).
+		Where("", "id <> $1", 1).
+		Paginate([]string{"id"}, cursor, 10).
+		Envelope()
+	_, args, err := paged.ToSql()
+	assert.NoError(t, err)
+	assert.Equal(t, []any{1, `{"id":5}`}, args)
+	snapshotQbAsync(t, &wg, paged, file+"2.sql")
+
+	snapshotQbAsync(t, &wg, qb().
+		Select(User{}, func(cond string) (string, []any, error) { return "select * from users", nil, nil }).
+		Envelope(), file+"3.sql")
+
+	page, err := jagger.New[User]().Envelope().UnmarshalPage([]byte(`{"data": [{"id": 1}], "total": 3, "has_more": true, "cursor": "abc"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, jagger.Page[User]{Data: []User{{ID: 1}}, Total: 3, HasMore: true, Cursor: "abc"}, page)
+}
+
+func TestEnvelopeJoins(t *testing.T) {
+	t.Parallel()
+
+	// inner joins would drop root rows after they are counted
+	_, _, err := qb().Select(User{}, nil).InnerJoin("Songs", nil).Envelope().ToSql()
+	assert.ErrorIs(t, err, jagger.ErrInvalidPage)
+
+	_, _, err = qb().Select(User{}, nil).InnerJoin("Songs", nil).Paginate([]string{"id"}, "", 10).ToSql()
+	assert.ErrorIs(t, err, jagger.ErrInvalidPage)
+
+	// relations of one relations are joined onto the root rows too
+	_, _, err = qb().Select(SongTack{}, nil).LeftJoin("Song", nil).InnerJoin("Song.User", nil).Envelope().ToSql()
+	assert.ErrorIs(t, err, jagger.ErrInvalidPage)
+
+	// inside a many relation they only drop its rows
+	_, _, err = qb().Select(User{}, nil).LeftJoin("Songs", nil).InnerJoin("Songs.Tracks", nil).Paginate([]string{"id"}, "", 10).Envelope().ToSql()
+	assert.NoError(t, err)
+
+	_, _, err = qb().Select(User{}, nil).InnerJoin("Songs", nil).ToSql()
+	assert.NoError(t, err)
+}
+
+func TestEnvelopeEmptyPage(t *testing.T) {
+	t.Parallel()
+
+	// past the last row, the page has no rows to carry the total
+	cursor := jagger.Cursor(base64.RawURLEncoding.EncodeToString([]byte(`{"id":1000000}`)))
+	// so it is counted apart from them, with the same conditions
+	paged := qb().Select(User{}, nil).Where("", "id > $1", 10).Paginate([]string{"-id"}, cursor, 10).Envelope()
+	_, args, err := paged.ToSql()
+	assert.NoError(t, err)
+	assert.Equal(t, []any{10, `{"id":1000000}`}, args)
+	snapshotQb(t, paged, TEST_SQL_BASE+"/test_envelope_empty_page1.sql")
+
+	page, err := jagger.New[User]().Envelope().UnmarshalPage([]byte(`{"data": [], "total": 3, "has_more": false, "cursor": ""}`))
+	assert.NoError(t, err)
+	assert.Equal(t, jagger.Page[User]{Data: []User{}, Total: 3}, page)
+}
+
+func TestBatch(t *testing.T) {
+	t.Parallel()
+
+	users, usersArgs, err := qb().Select(User{}, nil).Where("", "id = $1", 1).ToSql()
+	assert.NoError(t, err)
+
+	songs, _, err := qb().Select(UserSong{}, nil).Where("", "id = $1 or id = $2", 2, 3).ToSql()
+	assert.NoError(t, err)
+
+	batch := jagger.Batch{
+		"users": qb().Select(User{}, nil).Where("", "id = $1", 1),
+		"songs": qb().Select(UserSong{}, nil).Where("", "id = $1 or id = $2", 2, 3),
+	}
+
+	sql, args, err := batch.ToSql()
+	assert.NoError(t, err)
+	assert.Equal(t, []any{2, 3, 1}, args)
+	assert.Equal(t, fmt.Sprintf("select json_build_object('songs', (%s), 'users', (%s))",
+		songs, strings.ReplaceAll(users, "$1", "$3")), sql)
+	assert.Equal(t, []any{1}, usersArgs)
+
+	_, _, err = jagger.Batch{"users": qb().Select(User{}, nil).Paginate([]string{"id"}, "", 10)}.ToSql()
+	assert.ErrorIs(t, err, jagger.ErrInvalidPage)
+
+	_, _, err = jagger.Batch{"users": qb()}.ToSql()
+	assert.ErrorIs(t, err, jagger.ErrNoTarget)
+
+	_, _, err = jagger.Batch{"users": qb().Select(User{}, nil), "songs": nil}.ToSql()
+	assert.ErrorIs(t, err, jagger.ErrNoTarget)
+
+	var nilDest struct {
+		Songs []UserSong `json:"songs"`
+	}
+	assert.ErrorIs(t, jagger.Batch{"songs": nil}.Unmarshal([]byte(`{"songs": []}`), &nilDest), jagger.ErrNoTarget)
+
+	var dest struct {
+		Users []User     `json:"users"`
+		Songs []UserSong `json:"songs"`
+	}
+	assert.NoError(t, batch.Unmarshal([]byte(`{"users": [{"id": 1}], "songs": null}`), &dest))
+	assert.Equal(t, []User{{ID: 1}}, dest.Users)
+
+	var wrong struct {
+		Users []User `json:"users"`
+	}
+	assert.Error(t, batch.Unmarshal([]byte(`{}`), &wrong))
+}
+
+func TestCompact(t *testing.T) {
+	t.Parallel()
+
+	build := func() *jagger.QueryBuilder {
+		return qb().Select(User{}, nil).LeftJoin("Songs.Tracks", nil).LeftJoin("Songs.User", nil).Compact()
+	}
+
+	snapshotQb(t, build(), TEST_SQL_BASE+"/test_compact1.sql")
+
+	var users []User
+	err := build().Unmarshal([]byte(`[[1, [[10, 1, [1], [[100, 10]]], [11, 1, null, null]]]]`), &users)
+	assert.NoError(t, err)
+	assert.Equal(t, []User{{ID: 1, Songs: []UserSong{
+		{ID: 10, UserId: 1, User: &User{ID: 1}, Tracks: []SongTack{{ID: 100, SongId: 10}}},
+		{ID: 11, UserId: 1},
+	}}}, users)
+
+	err = build().Unmarshal([]byte(`[[1]]`), &users)
+	assert.ErrorContains(t, err, "decoding root: expected 2 values, got 1")
+
+	var embedded []EmbeddedUser
+	err = qb().Select(EmbeddedUser{}, nil).Compact().Unmarshal([]byte(`[[1, "b", "f"]]`), &embedded)
+	assert.NoError(t, err)
+	assert.Equal(t, []EmbeddedUser{{User: User{ID: 1}, SomeFieldBar: SomeFieldBar{Bar: "b"}, Foo: "f"}}, embedded)
+
+	page, err := jagger.New[User]().LeftJoin("Songs", nil).Envelope().Compact().
+		UnmarshalPage([]byte(`{"data": [[1, null]], "total": 1, "has_more": false}`))
+	assert.NoError(t, err)
+	assert.Equal(t, jagger.Page[User]{Data: []User{{ID: 1}}, Total: 1}, page)
+
+	users, err = jagger.New[User]().Compact().Unmarshal([]byte(`null`))
+	assert.NoError(t, err)
+	assert.Nil(t, users)
+}
+
+type Encoded struct {
+	jagger.BaseTable `jagger:"encoded"`
+
+	ID      int             `jagger:"id, pk:" json:"id"`
+	Data    []byte          `jagger:"data" json:"data"`
+	Raw     json.RawMessage `jagger:"raw" json:"raw"`
+	Amount  *big.Rat        `jagger:"amount" json:"amount"`
+	Total   string          `jagger:"total, cast:text" json:"total"`
+	Hash    string          `jagger:"hash, encode:hex" json:"hash"`
+	Created time.Time       `jagger:"created" json:"created"`
+	Addr    netip.Addr      `jagger:"addr" json:"addr"`
+}
+
+func TestEncoding(t *testing.T) {
+	t.Parallel()
+
+	sql, _, err := qb().Select(Encoded{}, nil).ToSql()
+	assert.NoError(t, err)
+	assert.Contains(t, sql, `'id', "encoded."."id",`+
+		`'data', encode("encoded."."data", 'base64'),`+
+		`'raw', "encoded."."raw",`+
+		`'amount', "encoded."."amount"::text,`+
+		`'total', "encoded."."total"::text,`+
+		`'hash', encode("encoded."."hash", 'hex'),`+
+		`'created', "encoded."."created",`+
+		`'addr', "encoded."."addr")`)
+
+	var encoded []Encoded
+	err = json.Unmarshal([]byte(`[{"id": 1, "data": "aGk=\n", "amount": "12345678901234567890.12345678901234567890"}]`), &encoded)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("hi"), encoded[0].Data)
+	assert.Equal(t, "12345678901234567890.12345678901234567890", encoded[0].Amount.FloatString(20))
+}
+
+// named like a decimal type, but only registered types are cast
+type Decimal struct{ s string }
+
+func (d *Decimal) UnmarshalText(b []byte) error {
+	d.s = string(b)
+	return nil
+}
+
+type Cents struct{ s string }
+
+func (c *Cents) UnmarshalText(b []byte) error {
+	c.s = string(b)
+	return nil
+}
+
+type Priced struct {
+	jagger.BaseTable `jagger:"priced"`
+
+	ID    int     `jagger:"id, pk:" json:"id"`
+	Price Decimal `jagger:"price" json:"price"`
+	Total *Cents  `jagger:"total" json:"total"`
+}
+
+func TestRegisterText(t *testing.T) {
+	t.Parallel()
+
+	jagger.RegisterText[Cents]()
+
+	sql, _, err := qb().Select(Priced{}, nil).ToSql()
+	assert.NoError(t, err)
+	assert.Contains(t, sql, `'price', "priced."."price",`)
+	assert.Contains(t, sql, `'total', "priced."."total"::text)`)
+}
+
+type Point struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+func (Point) JaggerExpr(alias, column string) string {
+	return fmt.Sprintf("json_build_object('x', st_x(%s.%s), 'y', st_y(%s.%s))", alias, column, alias, column)
+}
+
+type Money int64
+
+func (*Money) JaggerExpr(alias, column string) string {
+	return fmt.Sprintf("(%s.%s * 100)::bigint", alias, column)
+}
+
+type Place struct {
+	jagger.BaseTable `jagger:"place"`
+
+	ID       int    `jagger:"id, pk:" json:"id"`
+	Location *Point `jagger:"location" json:"location"`
+	Price    Money  `jagger:"price, cast:text" json:"price"`
+}
+
+type Geo interface {
+	JaggerExpr(alias, column string) string
+}
+
+type GeoPlace struct {
+	jagger.BaseTable `jagger:"place"`
+
+	ID       int `jagger:"id, pk:" json:"id"`
+	Location Geo `jagger:"location" json:"location"`
+}
+
+func TestExpr(t *testing.T) {
+	t.Parallel()
+
+	sql, _, err := qb().Select(Place{}, nil).ToSql()
+	assert.NoError(t, err)
+	assert.Contains(t, sql, `'location', json_build_object('x', st_x("place."."location"), 'y', st_y("place."."location")),`)
+	assert.Contains(t, sql, `'price', ("place."."price" * 100)::bigint::text`)
+
+	// an interface field is selected as is
+	sql, _, err = qb().Select(GeoPlace{}, nil).ToSql()
+	assert.NoError(t, err)
+	assert.Contains(t, sql, `'location', "place."."location"`)
+}
+
+type Address struct {
+	Street string `jagger:"street" json:"street"`
+	City   string `jagger:"city" json:"city"`
+}
+
+type Order struct {
+	jagger.BaseTable `jagger:"order"`
+
+	ID       int      `jagger:"id, pk:" json:"id"`
+	Billing  Address  `jagger:", embed, prefix:billing_" json:"billing"`
+	Shipping *Address `jagger:", embed, prefix:shipping_" json:"shipping"`
+}
+
+type PrefixedUser struct {
+	User    `jagger:", embed, prefix:user_"`
+	Address `jagger:", embed, prefix:home_"`
+}
+
+func TestEmbedPrefix(t *testing.T) {
+	t.Parallel()
+
+	sql, _, err := qb().Select(Order{}, nil).ToSql()
+	assert.NoError(t, err)
+	assert.Contains(t, sql, `json_build_object('id', "order."."id",`+
+		`'billing', json_build_object('street', "order."."billing_street",'city', "order."."billing_city"),`+
+		`'shipping', json_build_object('street', "order."."shipping_street",'city', "order."."shipping_city"))`)
+
+	var orders []Order
+	err = qb().Select(Order{}, nil).Compact().Unmarshal([]byte(`[[1, ["a", "b"], ["c", "d"]]]`), &orders)
+	assert.NoError(t, err)
+	assert.Equal(t, []Order{{ID: 1, Billing: Address{"a", "b"}, Shipping: &Address{"c", "d"}}}, orders)
+
+	sql, _, err = qb().Select(PrefixedUser{}, nil).ToSql()
+	assert.NoError(t, err)
+	assert.Contains(t, sql, `case when "user."."user_id" is null then null else json_strip_nulls(json_build_object('id', "user."."user_id",'street', "user."."home_street",'city', "user."."home_city"))`)
+}
+
+type Country struct {
+	jagger.BaseTable `jagger:"countries"`
+
+	ID int `jagger:"id, pk:" json:"id"`
+}
+
+type Located struct {
+	CountryID int      `jagger:"country_id" json:"country_id"`
+	Country   *Country `jagger:", fk:country_id" json:"country"`
+}
+
+type Shop struct {
+	jagger.BaseTable `jagger:"shops"`
+	Located          `jagger:", embed, prefix:billing_"`
+
+	ID int `jagger:"id, pk:" json:"id"`
+}
+
+type NestedShop struct {
+	jagger.BaseTable `jagger:"shops"`
+
+	ID      int     `jagger:"id, pk:" json:"id"`
+	Billing Located `jagger:", embed" json:"billing"`
+}
+
+func TestEmbedPrefixRelation(t *testing.T) {
+	t.Parallel()
+
+	sql, _, err := qb().Select(Shop{}, nil).LeftJoin("Country", nil).ToSql()
+	assert.NoError(t, err)
+	assert.Contains(t, sql, `'country_id', "shops."."billing_country_id"`)
+	assert.Contains(t, sql, `on "shops.country"."id" = "shops."."billing_country_id"`)
+	assert.NotContains(t, sql, `"shops."."country_id"`)
+
+	_, _, err = qb().Select(NestedShop{}, nil).ToSql()
+	assert.ErrorIs(t, err, jagger.ErrInvalidRelation)
+}
+
+type Timestamps struct {
+	CreatedAt string `jagger:"created_at" json:"created_at"`
+	UpdatedAt string `jagger:"updated_at" json:"updated_at"`
+}
+
+type Audit struct {
+	UpdatedAt string `jagger:"audit_updated_at" json:"updated_at"`
+	Note      string `jagger:"note" json:"note"`
+}
+
+type Revision struct {
+	Note string `jagger:"revision_note" json:"note"`
+}
+
+type Post struct {
+	jagger.BaseTable `jagger:"posts"`
+	Timestamps
+	*Audit
+	Revision
+
+	ID int `jagger:"id, pk:" json:"id"`
+}
+
+// embeds itself, which is not flattened again
+type Node struct {
+	jagger.BaseTable `jagger:"nodes"`
+	*Node
+
+	ID       int   `jagger:"id, pk:" json:"id"`
+	ParentID int   `jagger:"parent_id" json:"parent_id"`
+	Parent   *Node `jagger:", fk:parent_id" json:"parent"`
+}
+
+func TestAnonymousEmbedCycle(t *testing.T) {
+	t.Parallel()
+
+	// used to overflow the stack
+	_, _, err := qb().Select(Node{}, nil).LeftJoin("Parent", nil).ToSql()
+	assert.NoError(t, err)
+}
+
+func TestAnonymousEmbed(t *testing.T) {
+	t.Parallel()
+
+	sql, _, err := qb().Select(Post{}, nil).ToSql()
+	assert.NoError(t, err)
+	// updated_at from Timestamps and Audit are at the same depth, so is note from Audit and Revision
+	assert.Contains(t, sql, `json_build_object('created_at', "posts."."created_at",'id', "posts."."id")`)
+
+	var posts []Post
+	err = qb().Select(Post{}, nil).Compact().Unmarshal([]byte(`[["a", 1]]`), &posts)
+	assert.NoError(t, err)
+	assert.Equal(t, []Post{{Timestamps: Timestamps{CreatedAt: "a"}, ID: 1}}, posts)
+}
+
+type Venue struct {
+	jagger.BaseTable `jagger:"venues"`
+
+	ID      int      `jagger:"id, pk:" json:"id"`
+	Address *Address `jagger:", group" json:"address"`
+}
+
+func TestGroup(t *testing.T) {
+	t.Parallel()
+
+	snapshotQb(t, qb().Select(Venue{}, nil), TEST_SQL_BASE+"/test_group1.sql")
+
+	var venues []Venue
+	err := json.Unmarshal([]byte(`[{"id": 1, "address": null}, {"id": 2, "address": {"street": "a", "city": "b"}}]`), &venues)
+	assert.NoError(t, err)
+
+	var compact []Venue
+	err = qb().Select(Venue{}, nil).Compact().Unmarshal([]byte(`[[1, null], [2, ["a", "b"]]]`), &compact)
+	assert.NoError(t, err)
+	assert.Equal(t, venues, compact)
+	assert.Equal(t, []Venue{{ID: 1}, {ID: 2, Address: &Address{"a", "b"}}}, compact)
+}
+
+type KeyedSong struct {
+	jagger.BaseTable `jagger:"user_song"`
+
+	ID     int    `jagger:"id, pk:" json:"id"`
+	UserId int    `jagger:"user_id" json:"user_id"`
+	Slug   string `jagger:"slug" json:"slug"`
+}
+
+type KeyedUser struct {
+	jagger.BaseTable `jagger:"user"`
+
+	ID    int                  `jagger:"id, pk:" json:"id"`
+	Songs map[string]KeyedSong `jagger:", fk:user_id, key:slug" json:"songs"`
+}
+
+func TestMapRelation(t *testing.T) {
+	t.Parallel()
+
+	// ordered by the key and then the pk, so of duplicate keys the greatest pk is last
+	snapshotQb(t, qb().Select(KeyedUser{}, nil).LeftJoin("Songs", nil), TEST_SQL_BASE+"/test_map_relation1.sql")
+
+	// what postgres returns in that order, the last duplicate wins
+	data := `[{"id": 1, "songs": {"a": {"id": 2, "user_id": 1, "slug": "a"}, "a": {"id": 4, "user_id": 1, "slug": "a"}, "b": {"id": 3, "user_id": 1, "slug": "b"}}}]`
+	expected := []KeyedUser{{ID: 1, Songs: map[string]KeyedSong{"a": {ID: 4, UserId: 1, Slug: "a"}, "b": {ID: 3, UserId: 1, Slug: "b"}}}}
+
+	var users []KeyedUser
+	assert.NoError(t, json.Unmarshal([]byte(data), &users))
+	assert.Equal(t, expected, users)
+
+	users = nil
+	err := qb().Select(KeyedUser{}, nil).LeftJoin("Songs", nil).Compact().
+		Unmarshal([]byte(`[[1, {"a": [2, 1, "a"], "a": [4, 1, "a"], "b": [3, 1, "b"]}], [5, null]]`), &users)
+	assert.NoError(t, err)
+	assert.Equal(t, append(expected, KeyedUser{ID: 5}), users)
+}
+
+type BadKeyedUser struct {
+	jagger.BaseTable `jagger:"user"`
+
+	ID    int              `jagger:"id, pk:" json:"id"`
+	Songs map[int]UserSong `jagger:", fk:user_id" json:"songs"`
+}
+
+func TestMapRelationWithoutKey(t *testing.T) {
+	t.Parallel()
+
+	_, _, err := qb().Select(BadKeyedUser{}, nil).LeftJoin("Songs", nil).ToSql()
+	assert.ErrorIs(t, err, jagger.ErrInvalidRelation)
+}
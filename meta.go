@@ -0,0 +1,102 @@
+package jagger
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/tronikelis/jagger/tags"
+)
+
+// FieldMeta is the precomputed description of a single struct field,
+// code generated by cmd/jagger-gen registers these so that
+// struct fields do not have to be walked with reflection at runtime
+type FieldMeta struct {
+	// the go field name
+	Name      string
+	Index     int
+	Anonymous bool
+	Type      reflect.Type
+	Tag       reflect.StructTag
+	Jagger    tags.JaggerTag
+}
+
+var registeredTables sync.Map
+
+// registers precomputed field metadata for T,
+// meant to be called from generated code in init,
+// metadata which does not match the fields of T anymore is ignored
+// and T is reflected, the generated code has to be regenerated then
+func RegisterTable[T any](fields ...FieldMeta) {
+	typ := reflect.TypeFor[T]()
+	if !matchesFields(typ, fields) {
+		registeredTables.Delete(typ)
+		return
+	}
+
+	registeredTables.Store(typ, fields)
+}
+
+// reports whether fields describe the fields of the struct typ in order, tags included
+func matchesFields(typ reflect.Type, fields []FieldMeta) bool {
+	if typ.Kind() != reflect.Struct || typ.NumField() != len(fields) {
+		return false
+	}
+
+	for i, f := range fields {
+		field := typ.Field(i)
+		if f.Index != i || f.Name != field.Name || f.Type != field.Type || f.Anonymous != field.Anonymous || f.Tag != field.Tag {
+			return false
+		}
+	}
+
+	return true
+}
+
+// set to parse jagger tags leniently like before, ignoring unknown
+// and malformed options, has to be set before building any queries
+var LenientTags = false
+
+// returns the registered fields of typ, or reflects them if it was not registered
+func structFields(typ reflect.Type) ([]FieldMeta, error) {
+	if fields, ok := registeredTables.Load(typ); ok {
+		return fields.([]FieldMeta), nil
+	}
+
+	fields := make([]FieldMeta, 0, typ.NumField())
+	for i := range typ.NumField() {
+		field := typ.Field(i)
+
+		var tag tags.JaggerTag
+		if LenientTags {
+			tag = tags.NewJaggerTagLenient(field.Tag)
+		} else {
+			var err error
+			tag, err = tags.NewJaggerTag(field.Tag)
+			if err != nil {
+				return nil, &TagError{Type: typ, Field: field.Name, Err: err}
+			}
+		}
+
+		fields = append(fields, FieldMeta{
+			Name:      field.Name,
+			Index:     i,
+			Anonymous: field.Anonymous,
+			Type:      field.Type,
+			Tag:       field.Tag,
+			Jagger:    tag,
+		})
+	}
+
+	return fields, nil
+}
+
+// joins a relation field onto a join path,
+// used by generated path builders
+func JoinPath(path string, field string) string {
+	if path == "" {
+		return field
+	}
+
+	return strings.Join([]string{path, field}, ".")
+}
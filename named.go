@@ -0,0 +1,48 @@
+package jagger
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+
+	"github.com/tronikelis/jagger/tags"
+)
+
+// merges named parameters, later ones override earlier ones
+func namedParams(params []any) (map[string]any, error) {
+	named := map[string]any{}
+
+	for _, p := range params {
+		if m, ok := p.(map[string]any); ok {
+			maps.Copy(named, m)
+			continue
+		}
+
+		v := reflect.ValueOf(p)
+		if v.Kind() == reflect.Pointer {
+			v = v.Elem()
+		}
+		if v.Kind() != reflect.Struct {
+			return nil, fmt.Errorf("%w, got %T", ErrInvalidNamed, p)
+		}
+
+		for i := range v.NumField() {
+			field := v.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+
+			name := tags.NewJaggerTagLenient(field.Tag).Name
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+
+			named[name] = v.Field(i).Interface()
+		}
+	}
+
+	return named, nil
+}
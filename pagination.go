@@ -0,0 +1,76 @@
+package jagger
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/tronikelis/jagger/relation"
+)
+
+// Cursor is an opaque position after the last row of a page,
+// returned in the jagger_cursor column, empty for the first page
+type Cursor string
+
+// Page is the json returned by an Envelope query
+type Page[T any] struct {
+	Data    []T    `json:"data"`
+	Total   int    `json:"total"`
+	HasMore bool   `json:"has_more"`
+	Cursor  Cursor `json:"cursor,omitempty"`
+}
+
+type page struct {
+	columns []string
+	after   Cursor
+	size    int
+}
+
+// the order columns often come from a request, so only mapped columns of the table are accepted
+func (p page) toRelation(table table) (*relation.Page, error) {
+	if len(p.columns) == 0 {
+		return nil, fmt.Errorf("%w, no order columns", ErrInvalidPage)
+	}
+
+	rp := &relation.Page{Size: p.size}
+
+	for _, c := range p.columns {
+		column := strings.TrimPrefix(c, "-")
+
+		mapped := slices.ContainsFunc(table.fields, func(f tableField) bool {
+			return f.tag.FK == "" && f.tag.Name == column
+		})
+		if !mapped {
+			return nil, fmt.Errorf("%w, %q is not a column of %v", ErrInvalidPage, column, table.typ)
+		}
+
+		rp.Desc = append(rp.Desc, strings.HasPrefix(c, "-"))
+		rp.Columns = append(rp.Columns, column)
+	}
+
+	if p.after == "" {
+		return rp, nil
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(string(p.after))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCursor, err)
+	}
+
+	var last map[string]json.RawMessage
+	if err := json.Unmarshal(decoded, &last); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCursor, err)
+	}
+
+	for _, c := range rp.Columns {
+		if _, ok := last[c]; !ok {
+			return nil, fmt.Errorf("%w, missing column %s", ErrInvalidCursor, c)
+		}
+	}
+
+	rp.After = string(decoded)
+
+	return rp, nil
+}
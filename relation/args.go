@@ -1,57 +1,174 @@
 package relation
 
 import (
+	"fmt"
+	"reflect"
 	"strconv"
 	"strings"
-	"unicode"
+
+	"github.com/tronikelis/jagger/internal/sqlscan"
 )
 
-func toIncrementedArgsQuery(query string, by int) (string, error) {
-	counts := struct {
-		quote  int
-		quotes int
-	}{}
-	runes := []rune(query)
+// Args collects the arguments of a rendered query
+type Args struct {
+	Values []any
 
-	builder := strings.Builder{}
-	acc := strings.Builder{}
+	// referenced as @name or :name in sub queries and conditions
+	Named map[string]any
+
+	// identical comparable values share one placeholder
+	Dedup bool
+
+	// $n of the named parameters which were already used
+	placeholders map[string]int
+	// $n of the values when deduplicating
+	values map[any]int
+}
+
+// appends v, returning its placeholder
+func (a *Args) add(v any) int {
+	dedup := a.Dedup && reflect.ValueOf(v).Comparable()
+	if dedup {
+		if n, ok := a.values[v]; ok {
+			return n
+		}
+	}
+
+	a.Values = append(a.Values, v)
+	n := len(a.Values)
+
+	if dedup {
+		if a.values == nil {
+			a.values = map[any]int{}
+		}
+		a.values[v] = n
+	}
+
+	return n
+}
+
+// appends the values of query, rewriting its positional and named placeholders
+func (a *Args) bind(query string, values []any) (string, error) {
+	by := len(a.Values)
+
+	placeholders := make([]int, len(values))
+	for i, v := range values {
+		placeholders[i] = a.add(v)
+	}
+
+	query, err := toMappedArgsQuery(query, func(n int) (int, error) {
+		if n >= 1 && n <= len(placeholders) {
+			return placeholders[n-1], nil
+		}
+
+		// can not be shifted when values are deduplicated
+		if a.Dedup {
+			return 0, fmt.Errorf("$%d without an argument, got %d arguments", n, len(values))
+		}
+
+		return n + by, nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return toNamedArgsQuery(query, a)
+}
+
+// returns the placeholder of a named parameter,
+// every name is appended to Values once and shares its placeholder
+func (a *Args) named(name string) (int, bool) {
+	if n, ok := a.placeholders[name]; ok {
+		return n, true
+	}
+
+	v, ok := a.Named[name]
+	if !ok {
+		return 0, false
+	}
+
+	if a.placeholders == nil {
+		a.placeholders = map[string]int{}
+	}
+
+	n := a.add(v)
+	a.placeholders[name] = n
 
-	for i := 0; i < len(runes); i++ {
-		builder.WriteRune(runes[i])
+	return n, true
+}
+
+// replaces @name and :name with positional placeholders,
+// unknown names and :: casts are left as is
+func toNamedArgsQuery(query string, args *Args) (string, error) {
+	if len(args.Named) == 0 {
+		return query, nil
+	}
 
-		if runes[i] == '$' && counts.quote%2 == 0 && counts.quotes%2 == 0 {
-			acc.WriteString(builder.String())
-			builder.Reset()
+	tokens, err := sqlscan.Tokenize(query)
+	if err != nil {
+		return "", err
+	}
 
-			for i+1 < len(runes) && unicode.IsDigit(runes[i+1]) {
+	builder := strings.Builder{}
+
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+
+		if t.Kind == sqlscan.Punct && (t.Text == "@" || t.Text == ":") &&
+			i+1 < len(tokens) && tokens[i+1].Kind == sqlscan.Ident &&
+			!(t.Text == ":" && i > 0 && tokens[i-1].Text == ":") {
+			if n, ok := args.named(tokens[i+1].Text); ok {
+				builder.WriteString("$" + strconv.Itoa(n))
 				i++
-				builder.WriteRune(runes[i])
-			}
-			if builder.Len() == 0 {
 				continue
 			}
+		}
 
-			num, err := strconv.Atoi(builder.String())
-			if err != nil {
-				return "", err
-			}
-			builder.Reset()
+		builder.WriteString(t.Text)
+	}
 
-			num += by
+	return builder.String(), nil
+}
+
+// IncrementArgs shifts the positional placeholders of query by by,
+// for combining rendered queries
+func IncrementArgs(query string, by int) (string, error) {
+	return toIncrementedArgsQuery(query, by)
+}
+
+// shifts positional placeholders by by
+func toIncrementedArgsQuery(query string, by int) (string, error) {
+	return toMappedArgsQuery(query, func(n int) (int, error) { return n + by, nil })
+}
+
+// replaces every positional placeholder $n with $mapping(n), placeholders inside
+// strings, dollar quoted strings, quoted identifiers and comments are not touched
+func toMappedArgsQuery(query string, mapping func(n int) (int, error)) (string, error) {
+	tokens, err := sqlscan.Tokenize(query)
+	if err != nil {
+		return "", err
+	}
+
+	builder := strings.Builder{}
 
-			acc.WriteString(strconv.Itoa(num))
+	for _, t := range tokens {
+		if t.Kind != sqlscan.Param {
+			builder.WriteString(t.Text)
 			continue
 		}
 
-		switch runes[i] {
-		case '"':
-			counts.quotes++
-		case '\'':
-			counts.quote++
+		num, err := strconv.Atoi(t.Text[1:])
+		if err != nil {
+			return "", err
 		}
-	}
 
-	acc.WriteString(builder.String())
+		num, err = mapping(num)
+		if err != nil {
+			return "", err
+		}
+
+		builder.WriteString("$" + strconv.Itoa(num))
+	}
 
-	return acc.String(), nil
+	return builder.String(), nil
 }
@@ -0,0 +1,85 @@
+package relation
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tronikelis/jagger/internal/sqlscan"
+)
+
+func TestToIncrementedArgsQuery(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		query    string
+		expected string
+	}{
+		{"select $1, $2", "select $11, $12"},
+		{"select '$1', $1", "select '$1', $11"},
+		{`select "$1", $1`, `select "$1", $11`},
+		{"select $$ $1 $$, $1", "select $$ $1 $$, $11"},
+		{"select $tag$ $1 ' $tag$, $1", "select $tag$ $1 ' $tag$, $11"},
+		{"select $1 -- $2 '\n, $2", "select $11 -- $2 '\n, $12"},
+		{"select /* $1 /* ' */ $2 */ $1", "select /* $1 /* ' */ $2 */ $11"},
+		{`select E'\' $1', $1`, `select E'\' $1', $11`},
+		{"select 'it''s $1', $1", "select 'it''s $1', $11"},
+		{"select a$1, $1", "select a$1, $11"},
+		{"select $1::int", "select $11::int"},
+	}
+
+	for _, c := range cases {
+		actual, err := toIncrementedArgsQuery(c.query, 10)
+		assert.NoError(t, err)
+		assert.Equal(t, c.expected, actual, c.query)
+	}
+
+	_, err := toIncrementedArgsQuery("select '$1", 10)
+	assert.Error(t, err)
+}
+
+func FuzzToIncrementedArgsQuery(f *testing.F) {
+	for _, seed := range []string{
+		"select $1",
+		"select '$1', $2",
+		"select $$ $1 $$",
+		"select $a$ $1 $a$ -- $2",
+		"/* $1 */ select E'\\' $1'",
+		`select "$1", a$1`,
+	} {
+		f.Add(seed, 3)
+	}
+
+	f.Fuzz(func(t *testing.T, query string, by int) {
+		if by < 0 || by > 1000 {
+			return
+		}
+
+		before, err := sqlscan.Tokenize(query)
+		if err != nil {
+			return
+		}
+
+		actual, err := toIncrementedArgsQuery(query, by)
+		if err != nil {
+			return
+		}
+
+		after, err := sqlscan.Tokenize(actual)
+		assert.NoError(t, err)
+		assert.Len(t, after, len(before))
+
+		for i := range min(len(before), len(after)) {
+			assert.Equal(t, before[i].Kind, after[i].Kind)
+
+			if before[i].Kind != sqlscan.Param {
+				assert.Equal(t, before[i].Text, after[i].Text)
+				continue
+			}
+
+			num, err := strconv.Atoi(before[i].Text[1:])
+			assert.NoError(t, err)
+			assert.Equal(t, "$"+strconv.Itoa(num+by), after[i].Text)
+		}
+	})
+}
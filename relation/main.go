@@ -2,14 +2,21 @@ package relation
 
 import (
 	"fmt"
+	"slices"
 	"strings"
 )
 
+// quotes a string literal
+func str(s string) string {
+	return fmt.Sprintf("'%s'", strings.ReplaceAll(s, "'", "''"))
+}
+
+// quotes and joins identifiers
 func col(cols ...string) string {
 	builder := strings.Builder{}
 
 	for i, col := range cols {
-		val := fmt.Sprintf(`"%s"`, col)
+		val := fmt.Sprintf(`"%s"`, strings.ReplaceAll(col, `"`, `""`))
 		if i < len(cols)-1 {
 			val += "."
 		}
@@ -31,9 +38,122 @@ const (
 	INNER_JOIN      JoinType = "inner join"
 )
 
+// Condition is an sql condition with $n placeholders for Args,
+// numbered from $1 like in a SubQuery
+type Condition struct {
+	Sql  string
+	Args []any
+}
+
+// Page limits the rows of a default sub query with keyset pagination
+type Page struct {
+	Columns []string
+	// whether each of the columns is ordered descending
+	Desc []bool
+
+	// json object with the columns of the last row of the previous page,
+	// empty for the first page
+	After string
+	// zero does not limit
+	Size int
+}
+
+func (p Page) columns() string {
+	columns := make([]string, len(p.Columns))
+	for i, c := range p.Columns {
+		columns[i] = col(c)
+	}
+
+	return strings.Join(columns, ", ")
+}
+
+func (p Page) orderBy() string {
+	columns := make([]string, len(p.Columns))
+	for i, c := range p.Columns {
+		columns[i] = col(c)
+		if p.Desc[i] {
+			columns[i] += " desc"
+		}
+	}
+
+	return strings.Join(columns, ", ")
+}
+
 type Field struct {
 	Json   string
 	Column string
+
+	// postgres type the column is cast to
+	Cast string
+	// format of the postgres encode function
+	Encode string
+	// builds the selected value from the quoted alias and column,
+	// Encode and Cast are applied to its result
+	Expr func(alias, column string) string
+
+	// makes this a nested object of the fields instead of a column
+	Fields []Field
+	// the nested object is null when all of its columns are null
+	Null bool
+
+	// index path of the go struct field, for decoding the compact format
+	Index []int
+}
+
+// the selected value of f, an object or array of its fields for groups
+func (f Field) value(name string, compact bool) string {
+	if f.Fields == nil {
+		return f.expr(name)
+	}
+
+	values := make([]string, len(f.Fields))
+	for i, child := range f.Fields {
+		values[i] = child.value(name, compact)
+		if !compact {
+			values[i] = fmt.Sprintf(`'%s', %s`, child.Json, values[i])
+		}
+	}
+
+	value := fmt.Sprintf("json_build_object(%s)", strings.Join(values, ","))
+	if compact {
+		value = fmt.Sprintf("json_build_array(%s)", strings.Join(values, ","))
+	}
+
+	if f.Null {
+		value = fmt.Sprintf("case when %s then null else %s end", strings.Join(f.nulls(name), " and "), value)
+	}
+
+	return value
+}
+
+// the columns of a group checked for null
+func (f Field) nulls(name string) []string {
+	if f.Fields == nil {
+		return []string{col(name, f.Column) + " is null"}
+	}
+
+	var nulls []string
+	for _, child := range f.Fields {
+		nulls = append(nulls, child.nulls(name)...)
+	}
+
+	return nulls
+}
+
+func (f Field) expr(name string) string {
+	expr := col(name, f.Column)
+	if f.Expr != nil {
+		expr = f.Expr(col(name), col(f.Column))
+	}
+
+	if f.Encode != "" {
+		expr = fmt.Sprintf("encode(%s, '%s')", expr, f.Encode)
+	}
+	if f.Cast != "" {
+		expr = fmt.Sprintf("%s::%s", expr, f.Cast)
+	}
+
+	return expr
 }
 
 type Relation struct {
@@ -47,10 +167,30 @@ type Relation struct {
 
 	FK       string
 	JsonName string
+	// index path of the go struct field in the parent, for decoding the compact format
+	Index []int
+	// aggregates the rows of a many relation into an object keyed by this column
+	// instead of an array, of rows with the same key the one with the greatest PK wins,
+	// the rows are ordered by the key and then the PK so that is deterministic
+	Key string
+
+	// the go join path, empty for the root
+	Path string
 
 	JoinType JoinType
 	SubQuery SubQuery
 
+	// ANDed with the join condition
+	Where []Condition
+
+	// only for the default sub query of the root
+	Page *Page
+	// only for the root, see envelope
+	Envelope bool
+	// rows are arrays of values in the order of Fields, One and Many
+	// instead of objects, has to be set on every relation
+	Compact bool
+
 	Fields []Field
 	One    []Relation
 	Many   []Relation
@@ -69,11 +209,50 @@ func (r Relation) nameJson() string {
 	return r.name() + "_json"
 }
 
+func (r Relation) aggregate() string {
+	if r.Key != "" {
+		key := col(r.name(), r.Key)
+
+		// without a pk the sub query has to order jagger_rn
+		order := col(r.name(), "jagger_rn")
+		if r.PK != "" {
+			order = col(r.name(), r.PK)
+		}
+
+		return fmt.Sprintf("json_object_agg(%s, %s order by %s, %s) filter (where %s is not null)",
+			key, r.jsonBuildObject(), key, order, key)
+	}
+
+	return fmt.Sprintf("json_agg(%s order by %s)", r.jsonBuildObject(), col(r.name(), "jagger_rn"))
+}
+
 func (r Relation) jsonAgg() string {
+	return fmt.Sprintf("%s %s", r.aggregate(), col(r.nameJson()))
+}
+
+// wraps the rows in an object with the page metadata,
+// total is the count of every page, or empty if the rows carry jagger_total
+func (r Relation) envelope(total string) string {
 	builder := strings.Builder{}
 
-	builder.WriteString(fmt.Sprintf("json_agg(%s", r.jsonBuildObject()))
-	builder.WriteString(fmt.Sprintf(" order by %s) %s", col(r.name(), "jagger_rn"), col(r.nameJson())))
+	if total == "" {
+		total = fmt.Sprintf("coalesce(max(%s), 0)", col(r.name(), "jagger_total"))
+	}
+
+	builder.WriteString(fmt.Sprintf("json_build_object('data', coalesce(%s, '[]')", r.aggregate()))
+	builder.WriteString(fmt.Sprintf(", 'total', %s", total))
+
+	hasMore := "false"
+	if r.Page != nil && r.Page.Size > 0 {
+		hasMore = fmt.Sprintf("coalesce(max(%s), 0) > %d", col(r.name(), "jagger_remaining"), r.Page.Size)
+	}
+	builder.WriteString(fmt.Sprintf(", 'has_more', %s", hasMore))
+
+	if r.Page != nil {
+		builder.WriteString(fmt.Sprintf(", 'cursor', %s", r.cursor()))
+	}
+
+	builder.WriteString(fmt.Sprintf(") %s", col(r.nameJson())))
 
 	return builder.String()
 }
@@ -99,25 +278,53 @@ func (self Relation) stripNulls(input string) string {
 func (r Relation) jsonBuildObject() string {
 	builder := strings.Builder{}
 
+	key := func(name string) string {
+		if r.Compact {
+			return ""
+		}
+
+		return fmt.Sprintf(`'%s', `, name)
+	}
+
 	for _, f := range r.Fields {
-		builder.WriteString(fmt.Sprintf(`'%s', %s,`, f.Json, col(r.name(), f.Column)))
+		builder.WriteString(fmt.Sprintf(`%s%s,`, key(f.Json), f.value(r.name(), r.Compact)))
 	}
 
 	for _, o := range r.One {
-		builder.WriteString(fmt.Sprintf(`'%s', %s,`, o.JsonName, o.jsonBuildObject()))
+		builder.WriteString(fmt.Sprintf(`%s%s,`, key(o.JsonName), o.jsonBuildObject()))
 	}
 
 	for _, m := range r.Many {
-		builder.WriteString(fmt.Sprintf(`'%s', %s,`, m.JsonName, col(m.nameJson())))
+		builder.WriteString(fmt.Sprintf(`%s%s,`, key(m.JsonName), col(m.nameJson())))
 	}
 
 	result := builder.String()
 	result = result[:len(result)-1]
 
+	if r.Compact {
+		return r.compact(result)
+	}
+
 	return r.stripNulls(result)
 }
 
-func (r Relation) oneJoin(args *[]any) (string, error) {
+// values of the row in an array, nulls have to keep their position
+func (r Relation) compact(input string) string {
+	builder := strings.Builder{}
+
+	if r.PK != "" {
+		builder.WriteString(fmt.Sprintf("case when %s is null then null else ", col(r.name(), r.PK)))
+	}
+
+	builder.WriteString(fmt.Sprintf("json_build_array(%s)", input))
+	if r.PK != "" {
+		builder.WriteString(" end")
+	}
+
+	return builder.String()
+}
+
+func (r Relation) oneJoin(args *Args) (string, error) {
 	builder := strings.Builder{}
 
 	for _, o := range r.One {
@@ -154,11 +361,11 @@ func (r Relation) onOneJoin(parent Relation, name string) string {
 	return fmt.Sprintf("%s = %s", col(name, r.PK), col(parent.name(), r.FK))
 }
 
-func (r Relation) manyJoin(args *[]any) (string, error) {
+func (r Relation) manyJoin(args *Args) (string, error) {
 	builder := strings.Builder{}
 
 	for _, m := range r.Many {
-		from, err := m.Render(&r, args)
+		from, err := m.RenderArgs(&r, args)
 		if err != nil {
 			return "", err
 		}
@@ -170,7 +377,7 @@ func (r Relation) manyJoin(args *[]any) (string, error) {
 	return builder.String(), nil
 }
 
-func (r Relation) join(args *[]any) (string, error) {
+func (r Relation) join(args *Args) (string, error) {
 	builder := strings.Builder{}
 
 	one, err := r.oneJoin(args)
@@ -189,33 +396,179 @@ func (r Relation) join(args *[]any) (string, error) {
 	return builder.String(), nil
 }
 
-func (r Relation) from(cond string, args *[]any) (string, error) {
+// ANDs cond and the where conditions, appending their args
+func (r Relation) conditions(cond string, args *Args) (string, error) {
+	var conditions []string
+	if cond != "" {
+		conditions = append(conditions, cond)
+	}
+
+	for _, w := range r.Where {
+		sql, err := args.bind(w.Sql, w.Args)
+		if err != nil {
+			return "", &SubQueryError{Path: r.Path, Err: err}
+		}
+
+		conditions = append(conditions, fmt.Sprintf("(%s)", sql))
+	}
+
+	return strings.Join(conditions, " and "), nil
+}
+
+// the keyset condition of the page, the cursor is cast to the row type of the table,
+// mixed directions can not compare rows and expand to (a < x) or (a = x and b > y)
+func (r Relation) after(args *Args) string {
+	op := func(i int) string {
+		if r.Page.Desc[i] {
+			return "<"
+		}
+		return ">"
+	}
+
+	n := args.add(r.Page.After)
+	last := func(columns string) string {
+		return fmt.Sprintf("(select %s from json_populate_record(null::%s, $%d::json))", columns, col(r.Table), n)
+	}
+
+	if !slices.Contains(r.Page.Desc, !r.Page.Desc[0]) {
+		return fmt.Sprintf("(%s) %s %s", r.Page.columns(), op(0), last(r.Page.columns()))
+	}
+
+	terms := make([]string, len(r.Page.Columns))
+	for i, c := range r.Page.Columns {
+		var and []string
+		for _, prev := range r.Page.Columns[:i] {
+			and = append(and, fmt.Sprintf("%s = %s", col(prev), last(col(prev))))
+		}
+		and = append(and, fmt.Sprintf("%s %s %s", col(c), op(i), last(col(c))))
+
+		terms[i] = fmt.Sprintf("(%s)", strings.Join(and, " and "))
+	}
+
+	return fmt.Sprintf("(%s)", strings.Join(terms, " or "))
+}
+
+// the encoded cursor of the last row,
+// base64url without padding, postgres wraps base64 lines
+func (r Relation) cursor() string {
+	builder := strings.Builder{}
+
+	for _, c := range r.Page.Columns {
+		builder.WriteString(fmt.Sprintf(`%s, %s,`, str(c), col(r.name(), c)))
+	}
+
+	object := builder.String()
+	object = object[:len(object)-1]
+
+	last := fmt.Sprintf("(array_agg(json_build_object(%s) order by %s desc))[1]", object, col(r.name(), "jagger_rn"))
+
+	return fmt.Sprintf(`coalesce(translate(encode(convert_to(%s::text, 'UTF8'), 'base64'), E'+/=\n', '-_'), '')`, last)
+}
+
+func (r Relation) from(cond string, args *Args) (string, error) {
+	from, _, err := r.fromTotal(cond, args)
+	return from, err
+}
+
+// like from, an envelope with a page also gets the count of every page,
+// it can not be a column of the rows as the page can be empty
+func (r Relation) fromTotal(cond string, args *Args) (string, string, error) {
+	if r.Page != nil && r.SubQuery != nil {
+		return "", "", &SubQueryError{Path: r.Path, Err: fmt.Errorf("pages can not be used with a sub query")}
+	}
+
 	if r.SubQuery == nil {
-		subQuery := fmt.Sprintf("select *, row_number() over () as jagger_rn from %s", col(r.Table))
-		if cond != "" {
-			subQuery += fmt.Sprintf(" where %s", cond)
+		where, err := r.conditions(cond, args)
+		if err != nil {
+			return "", "", err
+		}
+
+		source := col(r.Table)
+		total := ""
+		// extra window columns
+		columns := ""
+
+		if r.Envelope {
+			columns = ", count(*) over () as jagger_total"
+		}
+
+		over := ""
+		if r.Page != nil {
+			over = "order by " + r.Page.orderBy()
+
+			// the total has to be counted before skipping the previous pages
+			if r.Envelope {
+				total = fmt.Sprintf("(select count(*) from %s", source)
+				if where != "" {
+					total += fmt.Sprintf(" where %s", where)
+				}
+				total += ")"
+
+				columns = ", count(*) over () as jagger_remaining"
+			}
+
+			if r.Page.After != "" {
+				if where != "" {
+					where += " and "
+				}
+				where += r.after(args)
+			}
+		}
+
+		subQuery := fmt.Sprintf("select *, row_number() over (%s) as jagger_rn%s from %s", over, columns, source)
+		if where != "" {
+			subQuery += fmt.Sprintf(" where %s", where)
+		}
+
+		if r.Page != nil {
+			subQuery += " order by " + r.Page.orderBy()
+			if r.Page.Size > 0 {
+				subQuery += fmt.Sprintf(" limit %d", r.Page.Size)
+			}
 		}
 
-		return fmt.Sprintf("(%s) %s", subQuery, col(r.name())), nil
+		return fmt.Sprintf("(%s) %s", subQuery, col(r.name())), total, nil
 	}
 
 	subQuery, subQueryArgs, err := r.SubQuery(cond)
 	if err != nil {
-		return "", err
+		return "", "", &SubQueryError{Path: r.Path, Err: err}
 	}
 
-	incrementSubQueryBy := len(*args)
-	*args = append(*args, subQueryArgs...)
-
-	subQuery, err = toIncrementedArgsQuery(subQuery, incrementSubQueryBy)
+	subQuery, err = args.bind(subQuery, subQueryArgs)
 	if err != nil {
-		return "", err
+		return "", "", &SubQueryError{Path: r.Path, Err: err}
+	}
+
+	if len(r.Where) != 0 {
+		where, err := r.conditions("", args)
+		if err != nil {
+			return "", "", err
+		}
+
+		// jagger_rn of the sub query is kept, so the order does not change
+		subQuery = fmt.Sprintf("select * from (%s) %s where %s", subQuery, col(r.name()), where)
 	}
 
-	return fmt.Sprintf("(%s) %s", subQuery, col(r.name())), nil
+	if r.Envelope {
+		subQuery = fmt.Sprintf("select *, count(*) over () as jagger_total from (%s) %s", subQuery, col(r.name()))
+	}
+
+	return fmt.Sprintf("(%s) %s", subQuery, col(r.name())), "", nil
 }
 
+// renders the query appending its arguments to args
 func (r Relation) Render(parent *Relation, args *[]any) (string, error) {
+	a := &Args{Values: *args}
+
+	rendered, err := r.RenderArgs(parent, a)
+	*args = a.Values
+
+	return rendered, err
+}
+
+// renders the query, named parameters of the sub queries are resolved from args.Named
+func (r Relation) RenderArgs(parent *Relation, args *Args) (string, error) {
 	builder := strings.Builder{}
 	builder.WriteString("select ")
 
@@ -227,12 +580,21 @@ func (r Relation) Render(parent *Relation, args *[]any) (string, error) {
 	if parent != nil {
 		joinCond = r.onManyJoin(*parent, r.Table)
 	}
-	from, err := r.from(joinCond, args)
+	from, total, err := r.fromTotal(joinCond, args)
 	if err != nil {
 		return "", err
 	}
 
-	builder.WriteString(fmt.Sprintf("%s from lateral %s ", r.jsonAgg(), from))
+	switch {
+	case r.Envelope:
+		builder.WriteString(r.envelope(total))
+	case r.Page != nil:
+		builder.WriteString(fmt.Sprintf("%s, %s %s", r.jsonAgg(), r.cursor(), col("jagger_cursor")))
+	default:
+		builder.WriteString(r.jsonAgg())
+	}
+
+	builder.WriteString(fmt.Sprintf(" from lateral %s ", from))
 
 	join, err := r.join(args)
 	if err != nil {
@@ -251,3 +613,23 @@ func (r Relation) Render(parent *Relation, args *[]any) (string, error) {
 
 	return builder.String(), nil
 }
+
+// SubQueryError wraps the error of a failed SubQuery
+type SubQueryError struct {
+	// join path of the relation, empty for the root
+	Path string
+	Err  error
+}
+
+func (e *SubQueryError) Error() string {
+	path := e.Path
+	if path == "" {
+		path = "root"
+	}
+
+	return fmt.Sprintf("sub query of %s: %v", path, e.Err)
+}
+
+func (e *SubQueryError) Unwrap() error {
+	return e.Err
+}
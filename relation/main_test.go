@@ -0,0 +1,15 @@
+package relation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuoting(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, `"user"."id"`, col("user", "id"))
+	assert.Equal(t, `"a"" or ""b"`, col(`a" or "b`))
+	assert.Equal(t, `'it''s'`, str("it's"))
+}
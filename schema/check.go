@@ -0,0 +1,146 @@
+package schema
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Mapping is a go struct mapped onto a table by its jagger tags
+type Mapping struct {
+	// the go type name, used in messages
+	Type  string
+	Table string
+	// where the struct is declared, empty if unknown
+	Pos string
+
+	Fields []*MappedField
+}
+
+type MappedField struct {
+	// the go field name
+	Name string
+	// where the field is declared, empty if unknown
+	Pos string
+
+	Column string
+	PK     bool
+	FK     string
+
+	// the mapping of the related struct, nil for column fields
+	Target *Mapping
+	Many   bool
+}
+
+type Issue struct {
+	Pos     string
+	Message string
+}
+
+func (i Issue) Error() string {
+	if i.Pos == "" {
+		return i.Message
+	}
+
+	return i.Pos + ": " + i.Message
+}
+
+type checker struct {
+	schema  *Schema
+	visited map[*Mapping]bool
+	issues  []Issue
+}
+
+// checks that every table, column, primary key and foreign key declared
+// by the mappings and their relations exists in the schema
+func (s *Schema) Check(mappings ...*Mapping) []Issue {
+	c := &checker{schema: s, visited: map[*Mapping]bool{}}
+
+	for _, m := range mappings {
+		c.mapping(m)
+	}
+
+	return c.issues
+}
+
+// the go position if known, otherwise the schema position
+func (c *checker) report(goPos string, schemaPos Pos, format string, args ...any) {
+	pos := goPos
+	if pos == "" && schemaPos.File != "" {
+		pos = schemaPos.String()
+	}
+
+	c.issues = append(c.issues, Issue{Pos: pos, Message: fmt.Sprintf(format, args...)})
+}
+
+func (c *checker) mapping(m *Mapping) {
+	if c.visited[m] {
+		return
+	}
+	c.visited[m] = true
+
+	t := c.schema.Table(m.Table)
+	if t == nil {
+		c.report(m.Pos, Pos{}, "%s: table %s not found", m.Type, m.Table)
+	}
+
+	for _, f := range m.Fields {
+		if f.Target != nil {
+			c.mapping(f.Target)
+		}
+
+		if t == nil {
+			continue
+		}
+
+		if f.Target != nil {
+			c.relation(m, t, f)
+			continue
+		}
+
+		col := t.Column(f.Column)
+		if col == nil {
+			c.report(f.Pos, t.Pos, "%s.%s: column %s not found in table %s", m.Type, f.Name, f.Column, t.Name)
+			continue
+		}
+
+		if f.PK && !slices.Equal(t.PrimaryKey, []string{f.Column}) {
+			c.report(f.Pos, col.Pos, "%s.%s: column %s is not the primary key of table %s", m.Type, f.Name, f.Column, t.Name)
+		}
+	}
+}
+
+func (c *checker) relation(m *Mapping, t *Table, f *MappedField) {
+	target := c.schema.Table(f.Target.Table)
+	if target == nil {
+		// reported by the target mapping
+		return
+	}
+
+	// the foreign key always lives on the child table
+	child, parent := t, target
+	if f.Many {
+		child, parent = target, t
+	}
+
+	col := child.Column(f.FK)
+	if col == nil {
+		c.report(f.Pos, child.Pos, "%s.%s: column %s not found in table %s", m.Type, f.Name, f.FK, child.Name)
+		return
+	}
+
+	for _, fk := range child.ForeignKeys {
+		if slices.Equal(fk.Columns, []string{f.FK}) && c.schema.Table(qualified(fk.RefSchema, fk.RefTable)) == parent {
+			return
+		}
+	}
+
+	c.report(f.Pos, col.Pos, "%s.%s: missing foreign key %s(%s) references %s", m.Type, f.Name, child.Name, f.FK, parent.Name)
+}
+
+func qualified(schema string, table string) string {
+	if schema == "" {
+		return table
+	}
+
+	return schema + "." + table
+}
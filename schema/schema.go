@@ -0,0 +1,595 @@
+// Package schema reads the tables, columns and keys of a postgres schema
+// from DDL, for example the output of pg_dump --schema-only
+package schema
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/tronikelis/jagger/internal/sqlscan"
+)
+
+type Pos struct {
+	File string
+	Line int
+	Col  int
+}
+
+func (p Pos) String() string {
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Col)
+}
+
+type Column struct {
+	Name    string
+	Type    string
+	NotNull bool
+	Pos     Pos
+}
+
+type ForeignKey struct {
+	Columns []string
+
+	RefSchema  string
+	RefTable   string
+	RefColumns []string
+
+	Pos Pos
+}
+
+type Table struct {
+	Schema string
+	Name   string
+	Pos    Pos
+
+	Columns     []*Column
+	PrimaryKey  []string
+	ForeignKeys []*ForeignKey
+}
+
+func (t *Table) Column(name string) *Column {
+	for _, c := range t.Columns {
+		if c.Name == name {
+			return c
+		}
+	}
+
+	return nil
+}
+
+type Schema struct {
+	Tables []*Table
+}
+
+// finds a table by its name, the name can be schema qualified
+func (s *Schema) Table(name string) *Table {
+	schema, table, ok := strings.Cut(name, ".")
+	if !ok {
+		schema, table = "", name
+	}
+
+	for _, t := range s.Tables {
+		if t.Name == table && (schema == "" || t.Schema == schema) {
+			return t
+		}
+	}
+
+	return nil
+}
+
+func ParseFile(file string) (*Schema, error) {
+	src, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(file, string(src))
+}
+
+// parses CREATE TABLE and ALTER TABLE ... ADD CONSTRAINT statements,
+// everything else is skipped
+func Parse(file string, src string) (*Schema, error) {
+	tokens, err := sqlscan.Tokenize(src)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%w", file, err)
+	}
+
+	p := &parser{file: file, schema: &Schema{}}
+
+	var statement []sqlscan.Token
+	for _, tok := range tokens {
+		if tok.Kind == sqlscan.Whitespace || tok.Kind == sqlscan.Comment {
+			continue
+		}
+
+		if tok.Kind == sqlscan.Punct && tok.Text == ";" {
+			if err := p.statement(statement); err != nil {
+				return nil, err
+			}
+			statement = nil
+			continue
+		}
+
+		statement = append(statement, tok)
+	}
+
+	if err := p.statement(statement); err != nil {
+		return nil, err
+	}
+
+	for _, fk := range p.pending {
+		t := p.schema.Table(fk.table)
+		if t == nil {
+			return nil, fmt.Errorf("%s: alter of unknown table %s", fk.Pos, fk.table)
+		}
+		fk.apply(t)
+	}
+
+	return p.schema, nil
+}
+
+type parser struct {
+	file   string
+	schema *Schema
+
+	// constraints added by ALTER TABLE before the table was created
+	pending []*pendingConstraint
+
+	tokens []sqlscan.Token
+	i      int
+}
+
+type pendingConstraint struct {
+	table string
+	Pos   Pos
+
+	primaryKey []string
+	foreignKey *ForeignKey
+}
+
+func (c *pendingConstraint) apply(t *Table) {
+	if c.primaryKey != nil {
+		t.PrimaryKey = c.primaryKey
+		for _, name := range c.primaryKey {
+			if col := t.Column(name); col != nil {
+				col.NotNull = true
+			}
+		}
+	}
+	if c.foreignKey != nil {
+		t.ForeignKeys = append(t.ForeignKeys, c.foreignKey)
+	}
+}
+
+func (p *parser) pos(tok sqlscan.Token) Pos {
+	return Pos{File: p.file, Line: tok.Pos.Line, Col: tok.Pos.Col}
+}
+
+func (p *parser) peek() sqlscan.Token {
+	if p.i >= len(p.tokens) {
+		return sqlscan.Token{}
+	}
+
+	return p.tokens[p.i]
+}
+
+func (p *parser) next() sqlscan.Token {
+	tok := p.peek()
+	p.i++
+	return tok
+}
+
+func (p *parser) done() bool {
+	return p.i >= len(p.tokens)
+}
+
+// consumes the words if they are next
+func (p *parser) accept(words ...string) bool {
+	if p.i+len(words) > len(p.tokens) {
+		return false
+	}
+
+	for j, word := range words {
+		if !p.tokens[p.i+j].Is(word) {
+			return false
+		}
+	}
+
+	p.i += len(words)
+	return true
+}
+
+func (p *parser) acceptPunct(punct string) bool {
+	if tok := p.peek(); tok.Kind == sqlscan.Punct && tok.Text == punct {
+		p.i++
+		return true
+	}
+
+	return false
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	tok := p.peek()
+	if p.done() && len(p.tokens) != 0 {
+		tok = p.tokens[len(p.tokens)-1]
+	}
+
+	return fmt.Errorf("%s: %s", p.pos(tok), fmt.Sprintf(format, args...))
+}
+
+func (p *parser) ident() (string, error) {
+	tok := p.next()
+	if tok.Kind != sqlscan.Ident && tok.Kind != sqlscan.QuotedIdent {
+		p.i--
+		return "", p.errorf("expected identifier, got %q", tok.Text)
+	}
+
+	return tok.Value(), nil
+}
+
+// parses [schema.]name
+func (p *parser) qualifiedName() (string, string, error) {
+	name, err := p.ident()
+	if err != nil {
+		return "", "", err
+	}
+
+	if !p.acceptPunct(".") {
+		return "", name, nil
+	}
+
+	table, err := p.ident()
+	if err != nil {
+		return "", "", err
+	}
+
+	return name, table, nil
+}
+
+// parses (a, b, c)
+func (p *parser) identList() ([]string, error) {
+	if !p.acceptPunct("(") {
+		return nil, p.errorf("expected (")
+	}
+
+	var idents []string
+	for {
+		ident, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		idents = append(idents, ident)
+
+		if p.acceptPunct(")") {
+			return idents, nil
+		}
+		if !p.acceptPunct(",") {
+			return nil, p.errorf("expected , or )")
+		}
+	}
+}
+
+// skips tokens until one of the stop punctuations on the same paren depth
+func (p *parser) skip(stop ...string) []sqlscan.Token {
+	start := p.i
+	depth := 0
+
+	for !p.done() {
+		tok := p.peek()
+		if tok.Kind == sqlscan.Punct {
+			if depth == 0 {
+				for _, s := range stop {
+					if tok.Text == s {
+						return p.tokens[start:p.i]
+					}
+				}
+			}
+
+			switch tok.Text {
+			case "(", "[":
+				depth++
+			case ")", "]":
+				depth--
+			}
+		}
+
+		p.i++
+	}
+
+	return p.tokens[start:p.i]
+}
+
+func (p *parser) statement(tokens []sqlscan.Token) error {
+	p.tokens = tokens
+	p.i = 0
+
+	if !p.accept("create") {
+		if p.accept("alter", "table") {
+			return p.alterTable()
+		}
+		return nil
+	}
+
+	for p.accept("global") || p.accept("local") || p.accept("temporary") ||
+		p.accept("temp") || p.accept("unlogged") {
+	}
+
+	if !p.accept("table") {
+		return nil
+	}
+
+	return p.createTable()
+}
+
+func (p *parser) createTable() error {
+	p.accept("if", "not", "exists")
+
+	pos := p.pos(p.peek())
+	schema, name, err := p.qualifiedName()
+	if err != nil {
+		return err
+	}
+
+	// CREATE TABLE ... AS, PARTITION OF, OF type
+	if !p.acceptPunct("(") {
+		return nil
+	}
+
+	t := &Table{Schema: schema, Name: name, Pos: pos}
+
+	for !p.acceptPunct(")") {
+		if p.done() {
+			return p.errorf("unterminated table definition")
+		}
+
+		if err := p.tableElement(t); err != nil {
+			return err
+		}
+
+		p.acceptPunct(",")
+	}
+
+	p.schema.Tables = append(p.schema.Tables, t)
+
+	return nil
+}
+
+func (p *parser) tableElement(t *Table) error {
+	pos := p.pos(p.peek())
+
+	if p.accept("constraint") {
+		if _, err := p.ident(); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case p.accept("primary", "key"):
+		cols, err := p.identList()
+		if err != nil {
+			return err
+		}
+		t.PrimaryKey = cols
+		p.skip(",", ")")
+		return nil
+
+	case p.accept("foreign", "key"):
+		fk, err := p.foreignKey(pos)
+		if err != nil {
+			return err
+		}
+		t.ForeignKeys = append(t.ForeignKeys, fk)
+		p.skip(",", ")")
+		return nil
+
+	case p.accept("unique"), p.accept("check"), p.accept("exclude"), p.accept("like"):
+		p.skip(",", ")")
+		return nil
+	}
+
+	return p.column(t)
+}
+
+// parses FOREIGN KEY (cols) REFERENCES table [(cols)], FOREIGN KEY already consumed
+func (p *parser) foreignKey(pos Pos) (*ForeignKey, error) {
+	cols, err := p.identList()
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.accept("references") {
+		return nil, p.errorf("expected REFERENCES")
+	}
+
+	fk, err := p.references(pos)
+	if err != nil {
+		return nil, err
+	}
+	fk.Columns = cols
+
+	return fk, nil
+}
+
+// parses table [(cols)], REFERENCES already consumed
+func (p *parser) references(pos Pos) (*ForeignKey, error) {
+	schema, table, err := p.qualifiedName()
+	if err != nil {
+		return nil, err
+	}
+
+	fk := &ForeignKey{RefSchema: schema, RefTable: table, Pos: pos}
+
+	if tok := p.peek(); tok.Kind == sqlscan.Punct && tok.Text == "(" {
+		fk.RefColumns, err = p.identList()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return fk, nil
+}
+
+var columnConstraints = []string{
+	"constraint", "not", "null", "primary", "references", "default", "unique",
+	"check", "generated", "collate", "deferrable", "initially",
+}
+
+func isColumnConstraint(tok sqlscan.Token) bool {
+	for _, word := range columnConstraints {
+		if tok.Is(word) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// skips an expression which ends at a column constraint, a comma or a closing paren
+func (p *parser) expression() {
+	depth := 0
+
+	for !p.done() {
+		tok := p.peek()
+		if depth == 0 && (isColumnConstraint(tok) || (tok.Kind == sqlscan.Punct && (tok.Text == "," || tok.Text == ")"))) {
+			return
+		}
+
+		switch tok.Text {
+		case "(":
+			depth++
+		case ")":
+			depth--
+		}
+
+		p.i++
+	}
+}
+
+func (p *parser) column(t *Table) error {
+	pos := p.pos(p.peek())
+
+	name, err := p.ident()
+	if err != nil {
+		return err
+	}
+
+	col := &Column{Name: name, Pos: pos}
+
+	// the type is everything up to the first constraint
+	start := p.i
+	p.expression()
+	col.Type = typeString(p.tokens[start:p.i])
+
+	for !p.done() {
+		if tok := p.peek(); tok.Kind == sqlscan.Punct && (tok.Text == "," || tok.Text == ")") {
+			break
+		}
+
+		constraintPos := p.pos(p.peek())
+
+		switch {
+		case p.accept("constraint"):
+			if _, err := p.ident(); err != nil {
+				return err
+			}
+		case p.accept("not", "null"):
+			col.NotNull = true
+		case p.accept("primary", "key"):
+			col.NotNull = true
+			t.PrimaryKey = []string{name}
+		case p.accept("references"):
+			fk, err := p.references(constraintPos)
+			if err != nil {
+				return err
+			}
+			fk.Columns = []string{name}
+			t.ForeignKeys = append(t.ForeignKeys, fk)
+		default:
+			// DEFAULT, CHECK and friends, their expression runs up to the next constraint
+			p.next()
+			p.expression()
+		}
+	}
+
+	t.Columns = append(t.Columns, col)
+
+	return nil
+}
+
+// joins type tokens, "character varying ( 255 )" -> "character varying(255)"
+func typeString(tokens []sqlscan.Token) string {
+	builder := strings.Builder{}
+
+	for i, t := range tokens {
+		tok := t.Text
+		if i > 0 {
+			prev := tokens[i-1].Text
+			if tok != "(" && tok != ")" && tok != "," && tok != "[" && tok != "]" &&
+				tok != "." && prev != "(" && prev != "[" && prev != "." && prev != "," {
+				builder.WriteString(" ")
+			}
+		}
+
+		if t.Kind == sqlscan.Ident {
+			tok = strings.ToLower(tok)
+		}
+		builder.WriteString(tok)
+	}
+
+	return builder.String()
+}
+
+func (p *parser) alterTable() error {
+	p.accept("if", "exists")
+	p.accept("only")
+
+	schema, name, err := p.qualifiedName()
+	if err != nil {
+		return err
+	}
+	table := name
+	if schema != "" {
+		table = schema + "." + name
+	}
+
+	for !p.done() {
+		pos := p.pos(p.peek())
+
+		if !p.accept("add") {
+			p.skip(",")
+			p.acceptPunct(",")
+			continue
+		}
+
+		if p.accept("constraint") {
+			if _, err := p.ident(); err != nil {
+				return err
+			}
+		}
+
+		c := &pendingConstraint{table: table, Pos: pos}
+
+		switch {
+		case p.accept("primary", "key"):
+			c.primaryKey, err = p.identList()
+		case p.accept("foreign", "key"):
+			c.foreignKey, err = p.foreignKey(pos)
+		}
+		if err != nil {
+			return err
+		}
+
+		if c.primaryKey != nil || c.foreignKey != nil {
+			if t := p.schema.Table(table); t != nil {
+				c.apply(t)
+			} else {
+				p.pending = append(p.pending, c)
+			}
+		}
+
+		p.skip(",")
+		p.acceptPunct(",")
+	}
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFile(t *testing.T) {
+	t.Parallel()
+
+	s, err := ParseFile("testdata/dump.sql")
+	assert.NoError(t, err)
+	assert.Len(t, s.Tables, 3)
+
+	users := s.Table("public.users")
+	assert.NotNil(t, users)
+	assert.Equal(t, []string{"id"}, users.PrimaryKey)
+	assert.Equal(t, &Column{Name: "id", Type: "bigint", NotNull: true, Pos: Pos{"testdata/dump.sql", 18, 5}}, users.Column("id"))
+	assert.Equal(t, "character varying(255)", users.Column("name").Type)
+	assert.True(t, users.Column("name").NotNull)
+	assert.False(t, users.Column("Email").NotNull)
+	assert.Equal(t, "timestamp with time zone", users.Column("created_at").Type)
+
+	songs := s.Table("songs")
+	assert.Equal(t, []string{"id"}, songs.PrimaryKey)
+	assert.Equal(t, []string{"id", "user_id", "title", "tags", "price"}, columnNames(songs))
+	assert.Equal(t, "text[]", songs.Column("tags").Type)
+	assert.Equal(t, "numeric(10,2)", songs.Column("price").Type)
+	assert.Equal(t, []*ForeignKey{{
+		Columns:    []string{"user_id"},
+		RefSchema:  "public",
+		RefTable:   "users",
+		RefColumns: []string{"id"},
+		Pos:        Pos{"testdata/dump.sql", 47, 5},
+	}}, songs.ForeignKeys)
+
+	playlists := s.Table("playlists")
+	assert.Equal(t, []string{"id"}, playlists.PrimaryKey)
+	assert.Len(t, playlists.ForeignKeys, 2)
+	assert.Equal(t, "users", playlists.ForeignKeys[0].RefTable)
+	assert.Equal(t, []string{"owner_id"}, playlists.ForeignKeys[0].Columns)
+	assert.Equal(t, "songs", playlists.ForeignKeys[1].RefTable)
+	assert.Nil(t, playlists.ForeignKeys[1].RefColumns)
+}
+
+func columnNames(t *Table) []string {
+	var names []string
+	for _, c := range t.Columns {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+func TestParseErrors(t *testing.T) {
+	t.Parallel()
+
+	_, err := Parse("x.sql", "create table foo (id int")
+	assert.ErrorContains(t, err, "x.sql:1:")
+
+	_, err = Parse("x.sql", "alter table foo add constraint a primary key (id)")
+	assert.ErrorContains(t, err, "unknown table foo")
+
+	_, err = Parse("x.sql", "create table 'foo' (id int)")
+	assert.ErrorContains(t, err, "expected identifier")
+}
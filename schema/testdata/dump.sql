@@ -0,0 +1,47 @@
+--
+-- PostgreSQL database dump
+--
+
+SET statement_timeout = 0;
+SELECT pg_catalog.set_config('search_path', '', false);
+
+CREATE FUNCTION public.touch() RETURNS trigger
+    LANGUAGE plpgsql
+    AS $$
+begin
+  new.updated_at = now(); -- create table nope (id int);
+  return new;
+end;
+$$;
+
+CREATE TABLE public.users (
+    id bigint NOT NULL,
+    name character varying(255) DEFAULT ''::character varying NOT NULL,
+    "Email" text,
+    created_at timestamp with time zone DEFAULT now() NOT NULL
+);
+
+CREATE TABLE public.songs (
+    id integer NOT NULL,
+    user_id bigint NOT NULL,
+    title text DEFAULT NULL,
+    tags text[],
+    price numeric(10,2) CHECK (price > 0),
+    CONSTRAINT songs_title_check CHECK ((length(title) > 0))
+);
+
+CREATE TABLE IF NOT EXISTS playlists (
+    id serial PRIMARY KEY,
+    owner_id bigint REFERENCES users (id) ON DELETE CASCADE,
+    song_id integer,
+    FOREIGN KEY (song_id) REFERENCES songs
+);
+
+ALTER TABLE public.users OWNER TO postgres;
+
+ALTER TABLE ONLY public.users
+    ADD CONSTRAINT users_pkey PRIMARY KEY (id);
+
+ALTER TABLE ONLY public.songs
+    ADD CONSTRAINT songs_pkey PRIMARY KEY (id),
+    ADD CONSTRAINT songs_user_id_fkey FOREIGN KEY (user_id) REFERENCES public.users(id);
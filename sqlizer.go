@@ -0,0 +1,63 @@
+package jagger
+
+import (
+	"errors"
+	"slices"
+
+	"github.com/tronikelis/jagger/internal/sqlscan"
+)
+
+// ErrPlaceholders is returned when a Sqlizer has arguments
+// but does not use $n placeholders
+var ErrPlaceholders = errors.New("Sqlizer has to use $n placeholders")
+
+// Sqlizer is implemented by query builders like squirrel
+type Sqlizer interface {
+	ToSql() (string, []any, error)
+}
+
+// adapts a method value like goqu's (*SelectDataset).ToSQL to Sqlizer
+type SqlizerFunc func() (string, []any, error)
+
+func (f SqlizerFunc) ToSql() (string, []any, error) {
+	return f()
+}
+
+func sqlize(s Sqlizer) (string, []any, error) {
+	sql, args, err := s.ToSql()
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(args) == 0 {
+		return sql, args, nil
+	}
+
+	tokens, err := sqlscan.Tokenize(sql)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// squirrel defaults to ?, this would silently pass wrong arguments
+	if !slices.ContainsFunc(tokens, func(t sqlscan.Token) bool { return t.Kind == sqlscan.Param }) {
+		return "", nil, ErrPlaceholders
+	}
+
+	return sql, args, nil
+}
+
+// uses the query of s as the sub query, the join condition is not used,
+// s has to select jagger_rn like any other sub query
+func FromSqlizer(s Sqlizer) SubQuery {
+	return func(string) (string, []any, error) {
+		return sqlize(s)
+	}
+}
+
+// builds the sub query with the join condition,
+// for example with squirrel's .Where(cond) or goqu's .Where(goqu.L(cond))
+func FromSqlizerFunc(fn func(cond string) Sqlizer) SubQuery {
+	return func(cond string) (string, []any, error) {
+		return sqlize(fn(cond))
+	}
+}
@@ -1,18 +1,141 @@
 package tags
 
 import (
+	"fmt"
 	"reflect"
+	"slices"
 	"strings"
 )
 
+// every option key understood by NewJaggerTag
+var Keys = []string{"pk", "fk", "embed", "cast", "encode", "prefix", "group", "key"}
+
+// formats of the postgres encode function accepted by the encode option
+var Encodings = []string{"base64", "hex", "escape"}
+
 type JaggerTag struct {
 	Name  string
 	PK    bool
 	FK    string
 	Embed bool
+	// postgres type the column is cast to
+	Cast string
+	// the column is passed through encode(column, Encode)
+	Encode string
+	// prepended to the columns of an embedded struct
+	Prefix string
+	// nests the columns of a struct under its json key,
+	// null when all of them are null
+	Group bool
+	// column of the relation the rows of a map relation are keyed by
+	Key string
+}
+
+// Error describes an invalid option in a jagger tag
+type Error struct {
+	// the offending option, as written in the tag
+	Token  string
+	Reason string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("invalid jagger tag option %q: %s", e.Token, e.Reason)
+}
+
+// parses the jagger tag, unknown, duplicate and malformed options are errors
+func NewJaggerTag(tag reflect.StructTag) (JaggerTag, error) {
+	dt := JaggerTag{}
+
+	comma := strings.Split(tag.Get("jagger"), ",")
+	dt.Name = strings.TrimSpace(comma[0])
+
+	seen := map[string]bool{}
+
+	for _, token := range comma[1:] {
+		option := strings.TrimSpace(token)
+		if option == "" {
+			return JaggerTag{}, &Error{Token: token, Reason: "empty option"}
+		}
+
+		colon := strings.Split(option, ":")
+		if len(colon) > 2 {
+			return JaggerTag{}, &Error{Token: option, Reason: "more than one value"}
+		}
+
+		key := colon[0]
+		value := ""
+		if len(colon) == 2 {
+			value = colon[1]
+		}
+
+		if !slices.Contains(Keys, key) {
+			return JaggerTag{}, &Error{Token: option, Reason: "unknown key " + key}
+		}
+		if seen[key] {
+			return JaggerTag{}, &Error{Token: option, Reason: "duplicate key " + key}
+		}
+		seen[key] = true
+
+		switch key {
+		case "pk":
+			if value != "" {
+				return JaggerTag{}, &Error{Token: option, Reason: "pk does not take a value"}
+			}
+			dt.PK = true
+		case "fk":
+			if value == "" {
+				return JaggerTag{}, &Error{Token: option, Reason: "fk requires a column"}
+			}
+			dt.FK = value
+		case "embed":
+			if value != "" {
+				return JaggerTag{}, &Error{Token: option, Reason: "embed does not take a value"}
+			}
+			dt.Embed = true
+		case "cast":
+			if value == "" {
+				return JaggerTag{}, &Error{Token: option, Reason: "cast requires a type"}
+			}
+			dt.Cast = value
+		case "encode":
+			if !slices.Contains(Encodings, value) {
+				return JaggerTag{}, &Error{Token: option, Reason: "encode requires one of " + strings.Join(Encodings, ", ")}
+			}
+			dt.Encode = value
+		case "prefix":
+			if value == "" {
+				return JaggerTag{}, &Error{Token: option, Reason: "prefix requires a value"}
+			}
+			dt.Prefix = value
+		case "group":
+			if value != "" {
+				return JaggerTag{}, &Error{Token: option, Reason: "group does not take a value"}
+			}
+			dt.Group = true
+		case "key":
+			if value == "" {
+				return JaggerTag{}, &Error{Token: option, Reason: "key requires a column"}
+			}
+			dt.Key = value
+		}
+	}
+
+	if dt.Prefix != "" && !dt.Embed && !dt.Group {
+		return JaggerTag{}, &Error{Token: "prefix:" + dt.Prefix, Reason: "prefix requires embed or group"}
+	}
+	if dt.Key != "" && dt.FK == "" {
+		return JaggerTag{}, &Error{Token: "key:" + dt.Key, Reason: "key requires fk"}
+	}
+	if dt.Group && (dt.Embed || dt.FK != "") {
+		return JaggerTag{}, &Error{Token: "group", Reason: "group can not be used with embed or fk"}
+	}
+
+	return dt, nil
 }
 
-func NewJaggerTag(tag reflect.StructTag) JaggerTag {
+// parses the jagger tag ignoring anything unexpected,
+// this is how tags were parsed before NewJaggerTag became strict
+func NewJaggerTagLenient(tag reflect.StructTag) JaggerTag {
 	dt := JaggerTag{}
 
 	comma := strings.Split(tag.Get("jagger"), ",")
@@ -28,6 +151,16 @@ func NewJaggerTag(tag reflect.StructTag) JaggerTag {
 			dt.FK = v
 		case "embed":
 			dt.Embed = true
+		case "cast":
+			dt.Cast = v
+		case "encode":
+			dt.Encode = v
+		case "prefix":
+			dt.Prefix = v
+		case "group":
+			dt.Group = true
+		case "key":
+			dt.Key = v
 		}
 	}
 
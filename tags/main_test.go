@@ -0,0 +1,66 @@
+package tags
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewJaggerTag(t *testing.T) {
+	t.Parallel()
+
+	for tag, expected := range map[reflect.StructTag]JaggerTag{
+		`jagger:"id"`:                   {Name: "id"},
+		`jagger:"id, pk:"`:              {Name: "id", PK: true},
+		`jagger:"id,pk"`:                {Name: "id", PK: true},
+		`jagger:", fk:user_id"`:         {FK: "user_id"},
+		`jagger:",embed:"`:              {Embed: true},
+		`jagger:"id with space,pk:"`:    {Name: "id with space", PK: true},
+		`json:"id"`:                     {},
+		`jagger:"amount,cast:text"`:     {Name: "amount", Cast: "text"},
+		`jagger:"data,encode:hex"`:      {Name: "data", Encode: "hex"},
+		`jagger:",embed,prefix:a_"`:     {Embed: true, Prefix: "a_"},
+		`jagger:",group"`:               {Group: true},
+		`jagger:",group,prefix:a_"`:     {Group: true, Prefix: "a_"},
+		`jagger:",fk:user_id,key:slug"`: {FK: "user_id", Key: "slug"},
+	} {
+		parsed, err := NewJaggerTag(tag)
+		assert.NoError(t, err, tag)
+		assert.Equal(t, expected, parsed, tag)
+	}
+}
+
+func TestNewJaggerTagErrors(t *testing.T) {
+	t.Parallel()
+
+	for tag, expected := range map[reflect.StructTag]string{
+		`jagger:"id,pkk:"`:          `invalid jagger tag option "pkk:": unknown key pkk`,
+		`jagger:",fk:a:b"`:          `invalid jagger tag option "fk:a:b": more than one value`,
+		`jagger:",fk:"`:             `invalid jagger tag option "fk:": fk requires a column`,
+		`jagger:"id,pk:,pk:"`:       `invalid jagger tag option "pk:": duplicate key pk`,
+		`jagger:"id,pk:yes"`:        `invalid jagger tag option "pk:yes": pk does not take a value`,
+		`jagger:",embed:x"`:         `invalid jagger tag option "embed:x": embed does not take a value`,
+		`jagger:"id,"`:              `invalid jagger tag option "": empty option`,
+		`jagger:"id,cast:"`:         `invalid jagger tag option "cast:": cast requires a type`,
+		`jagger:"id,encode:x"`:      `invalid jagger tag option "encode:x": encode requires one of base64, hex, escape`,
+		`jagger:",prefix:a_"`:       `invalid jagger tag option "prefix:a_": prefix requires embed or group`,
+		`jagger:",group:x"`:         `invalid jagger tag option "group:x": group does not take a value`,
+		`jagger:",group,embed"`:     `invalid jagger tag option "group": group can not be used with embed or fk`,
+		`jagger:",fk:user_id,key:"`: `invalid jagger tag option "key:": key requires a column`,
+		`jagger:"slug,key:slug"`:    `invalid jagger tag option "key:slug": key requires fk`,
+	} {
+		_, err := NewJaggerTag(tag)
+		assert.EqualError(t, err, expected, tag)
+
+		var tagErr *Error
+		assert.ErrorAs(t, err, &tagErr)
+	}
+}
+
+func TestNewJaggerTagLenient(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, JaggerTag{Name: "id", FK: ""}, NewJaggerTagLenient(`jagger:"id,pkk:,fk:a:b"`))
+	assert.Equal(t, JaggerTag{Name: "id", PK: true}, NewJaggerTagLenient(`jagger:"id,pk:yes,"`))
+}
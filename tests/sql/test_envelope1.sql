@@ -0,0 +1 @@
+select json_build_object('data', coalesce(json_agg(case when "user."."id" is null then null else json_strip_nulls(json_build_object('id', "user."."id")) end order by "user."."jagger_rn"), '[]'), 'total', coalesce(max("user."."jagger_total"), 0), 'has_more', false) "user._json" from lateral (select *, row_number() over () as jagger_rn, count(*) over () as jagger_total from "user") "user." 
\ No newline at end of file
@@ -0,0 +1 @@
+select json_build_object('data', coalesce(json_agg(case when "user."."id" is null then null else json_strip_nulls(json_build_object('id', "user."."id")) end order by "user."."jagger_rn"), '[]'), 'total', (select count(*) from "user" where (id > $1)), 'has_more', coalesce(max("user."."jagger_remaining"), 0) > 10, 'cursor', coalesce(translate(encode(convert_to((array_agg(json_build_object('id', "user."."id") order by "user."."jagger_rn" desc))[1]::text, 'UTF8'), 'base64'), E'+/=\n', '-_'), '')) "user._json" from lateral (select *, row_number() over (order by "id" desc) as jagger_rn, count(*) over () as jagger_remaining from "user" where (id > $1) and ("id") < (select "id" from json_populate_record(null::"user", $2::json)) order by "id" desc limit 10) "user." 
\ No newline at end of file
@@ -0,0 +1 @@
+select json_agg(case when "venues."."id" is null then null else json_strip_nulls(json_build_object('id', "venues."."id",'address', case when "venues."."street" is null and "venues."."city" is null then null else json_build_object('street', "venues."."street",'city', "venues."."city") end)) end order by "venues."."jagger_rn") "venues._json" from lateral (select *, row_number() over () as jagger_rn from "venues") "venues." 
\ No newline at end of file
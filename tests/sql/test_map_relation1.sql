@@ -0,0 +1 @@
+select json_agg(case when "user."."id" is null then null else json_strip_nulls(json_build_object('id', "user."."id",'songs', "user.songs_json")) end order by "user."."jagger_rn") "user._json" from lateral (select *, row_number() over () as jagger_rn from "user") "user." left join lateral (select "user.songs"."user_id", json_object_agg("user.songs"."slug", case when "user.songs"."id" is null then null else json_strip_nulls(json_build_object('id', "user.songs"."id",'user_id', "user.songs"."user_id",'slug', "user.songs"."slug")) end order by "user.songs"."slug", "user.songs"."id") filter (where "user.songs"."slug" is not null) "user.songs_json" from lateral (select *, row_number() over () as jagger_rn from "user_song" where "user_song"."user_id" = "user."."id") "user.songs" where "user.songs"."user_id" = "user."."id" group by "user.songs"."user_id") "user.songs" on "user.songs"."user_id" = "user."."id"
\ No newline at end of file
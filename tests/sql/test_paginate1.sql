@@ -0,0 +1 @@
+select json_agg(case when "user."."id" is null then null else json_strip_nulls(json_build_object('id', "user."."id")) end order by "user."."jagger_rn") "user._json", coalesce(translate(encode(convert_to((array_agg(json_build_object('id', "user."."id") order by "user."."jagger_rn" desc))[1]::text, 'UTF8'), 'base64'), E'+/=\n', '-_'), '') "jagger_cursor" from lateral (select *, row_number() over (order by "id") as jagger_rn from "user" order by "id" limit 10) "user." 
\ No newline at end of file
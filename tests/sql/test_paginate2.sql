@@ -0,0 +1 @@
+select json_agg(case when "articles."."id" is null then null else json_strip_nulls(json_build_object('id', "articles."."id",'name', "articles."."name",'created_at', "articles."."created_at")) end order by "articles."."jagger_rn") "articles._json", coalesce(translate(encode(convert_to((array_agg(json_build_object('name', "articles."."name",'id', "articles."."id") order by "articles."."jagger_rn" desc))[1]::text, 'UTF8'), 'base64'), E'+/=\n', '-_'), '') "jagger_cursor" from lateral (select *, row_number() over (order by "name" desc, "id" desc) as jagger_rn from "articles" where (id <> $1) and ("name", "id") < (select "name", "id" from json_populate_record(null::"articles", $2::json)) order by "name" desc, "id" desc limit 10) "articles." 
\ No newline at end of file
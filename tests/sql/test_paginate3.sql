@@ -0,0 +1 @@
+select json_agg(case when "articles."."id" is null then null else json_strip_nulls(json_build_object('id', "articles."."id",'name', "articles."."name",'created_at', "articles."."created_at")) end order by "articles."."jagger_rn") "articles._json", coalesce(translate(encode(convert_to((array_agg(json_build_object('created_at', "articles."."created_at",'id', "articles."."id") order by "articles."."jagger_rn" desc))[1]::text, 'UTF8'), 'base64'), E'+/=\n', '-_'), '') "jagger_cursor" from lateral (select *, row_number() over (order by "created_at" desc, "id") as jagger_rn from "articles" where (("created_at" < (select "created_at" from json_populate_record(null::"articles", $1::json))) or ("created_at" = (select "created_at" from json_populate_record(null::"articles", $1::json)) and "id" > (select "id" from json_populate_record(null::"articles", $1::json)))) order by "created_at" desc, "id" limit 10) "articles." 
\ No newline at end of file
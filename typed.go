@@ -0,0 +1,119 @@
+package jagger
+
+// TypedQueryBuilder is a QueryBuilder which knows the type it selects,
+// so results can be unmarshaled into []T directly
+type TypedQueryBuilder[T Table] struct {
+	qb *QueryBuilder
+}
+
+// creates a builder which selects T,
+// T has to have BaseTable embedded, this is checked by the compiler
+func New[T Table]() *TypedQueryBuilder[T] {
+	var table T
+	return &TypedQueryBuilder[T]{qb: NewQueryBuilder().Select(table, nil)}
+}
+
+func (tqb *TypedQueryBuilder[T]) with(qb *QueryBuilder) *TypedQueryBuilder[T] {
+	if qb == tqb.qb {
+		return tqb
+	}
+
+	return &TypedQueryBuilder[T]{qb: qb}
+}
+
+// sets the sub query for the root table
+func (tqb *TypedQueryBuilder[T]) Select(subQuery SubQuery) *TypedQueryBuilder[T] {
+	var table T
+	return tqb.with(tqb.qb.Select(table, subQuery))
+}
+
+func (tqb *TypedQueryBuilder[T]) Join(joinType JoinType, path string, subQuery SubQuery) *TypedQueryBuilder[T] {
+	return tqb.with(tqb.qb.Join(joinType, path, subQuery))
+}
+
+func (tqb *TypedQueryBuilder[T]) JoinAll(depth int, joinType JoinType) *TypedQueryBuilder[T] {
+	return tqb.with(tqb.qb.JoinAll(depth, joinType))
+}
+
+func (tqb *TypedQueryBuilder[T]) Where(path string, cond string, args ...any) *TypedQueryBuilder[T] {
+	return tqb.with(tqb.qb.Where(path, cond, args...))
+}
+
+func (tqb *TypedQueryBuilder[T]) Named(params any) *TypedQueryBuilder[T] {
+	return tqb.with(tqb.qb.Named(params))
+}
+
+func (tqb *TypedQueryBuilder[T]) DedupArgs() *TypedQueryBuilder[T] {
+	return tqb.with(tqb.qb.DedupArgs())
+}
+
+func (tqb *TypedQueryBuilder[T]) Paginate(orderColumns []string, after Cursor, pageSize int) *TypedQueryBuilder[T] {
+	return tqb.with(tqb.qb.Paginate(orderColumns, after, pageSize))
+}
+
+func (tqb *TypedQueryBuilder[T]) Envelope() *TypedQueryBuilder[T] {
+	return tqb.with(tqb.qb.Envelope())
+}
+
+func (tqb *TypedQueryBuilder[T]) Compact() *TypedQueryBuilder[T] {
+	return tqb.with(tqb.qb.Compact())
+}
+
+func (tqb *TypedQueryBuilder[T]) LeftJoin(path string, subQuery SubQuery) *TypedQueryBuilder[T] {
+	return tqb.with(tqb.qb.LeftJoin(path, subQuery))
+}
+
+func (tqb *TypedQueryBuilder[T]) RightJoin(path string, subQuery SubQuery) *TypedQueryBuilder[T] {
+	return tqb.with(tqb.qb.RightJoin(path, subQuery))
+}
+
+func (tqb *TypedQueryBuilder[T]) InnerJoin(path string, subQuery SubQuery) *TypedQueryBuilder[T] {
+	return tqb.with(tqb.qb.InnerJoin(path, subQuery))
+}
+
+func (tqb *TypedQueryBuilder[T]) FullOuterJoin(path string, subQuery SubQuery) *TypedQueryBuilder[T] {
+	return tqb.with(tqb.qb.FullOuterJoin(path, subQuery))
+}
+
+func (tqb *TypedQueryBuilder[T]) Immutable() *TypedQueryBuilder[T] {
+	return tqb.with(tqb.qb.Immutable())
+}
+
+func (tqb *TypedQueryBuilder[T]) Clone() *TypedQueryBuilder[T] {
+	return tqb.with(tqb.qb.Clone())
+}
+
+// returns the underlying untyped builder
+func (tqb *TypedQueryBuilder[T]) Untyped() *QueryBuilder {
+	return tqb.qb
+}
+
+func (tqb *TypedQueryBuilder[T]) ToSql() (string, []any, error) {
+	return tqb.qb.ToSql()
+}
+
+// calls .ToSql and panics if error
+func (tqb *TypedQueryBuilder[T]) MustSql() (string, []any) {
+	return tqb.qb.MustSql()
+}
+
+// unmarshals the json returned by postgres for this query,
+// no rows returns a nil slice
+func (tqb *TypedQueryBuilder[T]) Unmarshal(data []byte) ([]T, error) {
+	var result []T
+	if err := tqb.qb.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// unmarshals the json returned by postgres for an Envelope query
+func (tqb *TypedQueryBuilder[T]) UnmarshalPage(data []byte) (Page[T], error) {
+	var result Page[T]
+	if err := tqb.qb.Unmarshal(data, &result); err != nil {
+		return Page[T]{}, err
+	}
+
+	return result, nil
+}
@@ -0,0 +1,76 @@
+package jagger
+
+import (
+	"errors"
+	"reflect"
+
+	"github.com/tronikelis/jagger/schema"
+)
+
+type validator struct {
+	mappings map[reflect.Type]*schema.Mapping
+}
+
+func (v *validator) mapping(typ reflect.Type) (*schema.Mapping, error) {
+	for typ.Kind() == reflect.Pointer || typ.Kind() == reflect.Slice || typ.Kind() == reflect.Map {
+		typ = typ.Elem()
+	}
+
+	if m, ok := v.mappings[typ]; ok {
+		return m, nil
+	}
+
+	table, err := newTable(typ)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &schema.Mapping{Type: typ.Name(), Table: table.name}
+	// stored before the fields so cyclic relations end here
+	v.mappings[typ] = m
+
+	for _, f := range table.fields {
+		field := &schema.MappedField{Name: f.name, Column: f.tag.Name, PK: f.tag.PK, FK: f.tag.FK}
+
+		if f.tag.FK != "" {
+			field.Target, err = v.mapping(f.typ)
+			if err != nil {
+				return nil, err
+			}
+
+			fType := f.typ
+			if fType.Kind() == reflect.Pointer {
+				fType = fType.Elem()
+			}
+			field.Many = fType.Kind() == reflect.Slice || fType.Kind() == reflect.Map
+		}
+
+		m.Fields = append(m.Fields, field)
+	}
+
+	return m, nil
+}
+
+// checks every table name, column, pk and fk declared by the passed structs
+// and the structs they relate to against the schema,
+// all mismatches are joined into the returned error
+func Validate(s *schema.Schema, tables ...any) error {
+	v := &validator{mappings: map[reflect.Type]*schema.Mapping{}}
+
+	var mappings []*schema.Mapping
+	for _, t := range tables {
+		m, err := v.mapping(reflect.TypeOf(t))
+		if err != nil {
+			return err
+		}
+
+		mappings = append(mappings, m)
+	}
+
+	var errs []error
+	for _, issue := range s.Check(mappings...) {
+		errs = append(errs, issue)
+	}
+
+	return errors.Join(errs...)
+}